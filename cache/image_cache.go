@@ -0,0 +1,213 @@
+// image_cache
+package cache
+
+import (
+	"container/list"
+	"image"
+	"sync"
+)
+
+// Loader decodes the image of a key when it is not in the cache
+type Loader func(key string) (image.Image, error)
+
+// ImageCache keeps decoded images under a memory limit, the least recently used ones are dropped first.
+// an image is only loaded once even if many goroutines ask for it at the same time
+// 在内存限制内缓存解码后的图片, 超出限制时优先丢弃最久未使用的图片
+type ImageCache struct {
+	limit int64
+
+	mutex   sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List
+	size    int64
+	loading map[string]*call
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type entry struct {
+	key  string
+	img  image.Image
+	size int64
+}
+
+// a load in progress, others wait for it instead of decoding the same file again
+type call struct {
+	wg  sync.WaitGroup
+	img image.Image
+	err error
+}
+
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Items     int
+	Size      int64
+}
+
+// New creates a cache, limit is in bytes and 0 means no limit
+func New(limit int64) *ImageCache {
+	return &ImageCache{
+		limit:   limit,
+		items:   make(map[string]*list.Element, 0),
+		lru:     list.New(),
+		loading: make(map[string]*call, 0),
+	}
+}
+
+// Get returns the cached image of the key, or loads it with load
+func (c *ImageCache) Get(key string, load Loader) (image.Image, error) {
+
+	c.mutex.Lock()
+
+	if el, exist := c.items[key]; exist {
+		c.lru.MoveToFront(el)
+		c.hits += 1
+		c.mutex.Unlock()
+
+		return el.Value.(*entry).img, nil
+	}
+
+	c.misses += 1
+
+	if cl, exist := c.loading[key]; exist {
+		c.mutex.Unlock()
+		cl.wg.Wait()
+
+		return cl.img, cl.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+	c.loading[key] = cl
+
+	c.mutex.Unlock()
+
+	cl.img, cl.err = load(key)
+
+	c.mutex.Lock()
+
+	delete(c.loading, key)
+
+	if cl.err == nil {
+		c.add(key, cl.img)
+	}
+
+	c.mutex.Unlock()
+
+	cl.wg.Done()
+
+	return cl.img, cl.err
+}
+
+// Preload loads all the keys with some goroutines, the first error is returned
+func (c *ImageCache) Preload(keys []string, load Loader, workers int) error {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		jobs     = make(chan string)
+		wg       = sync.WaitGroup{}
+		errMutex = sync.Mutex{}
+		firstErr error
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for key := range jobs {
+				_, err := c.Get(key, load)
+
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		jobs <- key
+	}
+
+	close(jobs)
+
+	wg.Wait()
+
+	return firstErr
+}
+
+func (c *ImageCache) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Items:     len(c.items),
+		Size:      c.size,
+	}
+}
+
+// should be called with the lock held
+func (c *ImageCache) add(key string, img image.Image) {
+	size := ImageSize(img)
+
+	// never keep an image larger than the whole cache
+	if c.limit > 0 && size > c.limit {
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&entry{key: key, img: img, size: size})
+	c.size += size
+
+	for c.limit > 0 && c.size > c.limit {
+		last := c.lru.Back()
+		e := last.Value.(*entry)
+
+		c.lru.Remove(last)
+		delete(c.items, e.key)
+		c.size -= e.size
+		c.evictions += 1
+	}
+}
+
+// ImageSize is the memory used by the pixels of a decoded image
+func ImageSize(img image.Image) int64 {
+	switch m := img.(type) {
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Gray16:
+		return int64(len(m.Pix))
+	case *image.Alpha:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix) + len(m.Palette)*4)
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	}
+
+	b := img.Bounds()
+
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
@@ -0,0 +1,274 @@
+// commands
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golips_art_engine/engine"
+	"golips_art_engine/models"
+)
+
+func runValidate(args []string) error {
+
+	fs := newFlagSet("validate")
+
+	fs.Parse(args)
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	problems, warnings := newGenerator(config).Validate()
+
+	for _, p := range problems {
+		log.Println(p)
+	}
+
+	for _, w := range warnings {
+		log.Println("[Warning]", w)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+
+	for batch, c := range config.LayerConfigurations {
+		log.Printf("Batch %d: %d editions, %d layers, %s combinations (%.1f%% used)\n", batch, c.GrowEditionSizeTo, len(c.LayersOrder), engine.FormatCombinations(c.Combinations), engine.CombinationsUsed(c.GrowEditionSizeTo, c.Combinations))
+
+		for _, layer := range c.LayersOrder {
+			log.Printf("  %s: %d elements\n", layer.Options.DisplayName, len(layer.Elements))
+		}
+	}
+
+	log.Println("Config OK")
+
+	return nil
+}
+
+// count the traits from the metadata files, so the rarity file still works after editing metadata by hand
+func runRarity(args []string) error {
+
+	fs := newFlagSet("rarity")
+
+	fs.Parse(args)
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	count, err := newGenerator(config).UpdateRarity()
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rarity of %d editions saved to %s\n", count, filepath.Join(outputDir, engine.RarityFileName))
+
+	return nil
+}
+
+func runRegenerate(args []string) error {
+
+	fs := newFlagSet("regenerate")
+
+	seedFlag := fs.String("seed", "", "seed of the build, default is the seed in "+engine.BuildInfoFileName)
+	idsFlag := fs.String("ids", "", "editions to render again, such as 1,5,10-20, default is all")
+	processes := fs.String("processes", "", "how many editions are rendered at the same time, a number or 'auto', overrides processCount in config")
+
+	fs.Parse(args)
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	if *processes != "" {
+		config.ProcessCount = models.ProcessCount(*processes)
+	}
+
+	g := newGenerator(config)
+
+	var seed int64
+
+	if *seedFlag != "" {
+		seed, err = strconv.ParseInt(*seedFlag, 10, 64)
+	} else {
+		var info *models.BuildInfo
+
+		info, err = g.LoadBuildInfo()
+
+		if info != nil {
+			seed = info.Seed
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	history, err := g.LoadDnaHistory(filepath.Join(outputDir, engine.DnaHistoryFileName))
+
+	if err != nil {
+		return fmt.Errorf("regenerate needs the dna history, please turn on dnaSettings.saveDnaHistory: %s", err)
+	}
+
+	ids, err := parseIdList(*idsFlag)
+
+	if err != nil {
+		return err
+	}
+
+	problems, _ := g.Validate()
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in config:\n%s", len(problems), problems)
+	}
+
+	err = g.CreateOutputFolders()
+
+	if err != nil {
+		return err
+	}
+
+	editions := make([]*engine.Edition, 0)
+
+	for _, item := range history {
+		if ids != nil {
+			if !ids[item.Edition] {
+				continue
+			}
+
+			delete(ids, item.Edition)
+		}
+
+		ed, err := g.Replay(item.Edition, item.Batch, seed, item.Dna)
+
+		if err != nil {
+			return fmt.Errorf("edition %d: %s", item.Edition, err)
+		}
+
+		editions = append(editions, ed)
+	}
+
+	for id, _ := range ids {
+		return fmt.Errorf("edition %d is not in the dna history", id)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+
+	defer stop()
+
+	genCount, err := g.RenderEditions(ctx, editions)
+
+	if err != nil {
+		log.Printf("NFT Regenerated: %d of %d\n", genCount, len(editions))
+
+		return fmt.Errorf("regenerating failed:\n%s", err)
+	}
+
+	log.Printf("NFT Regenerated: %d\nAll Done!\n", genCount)
+
+	return nil
+}
+
+// rewrite the fields from config, attributes and dna are kept
+func runUpdateMetadata(args []string) error {
+
+	fs := newFlagSet("update-metadata")
+
+	fs.Parse(args)
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := newGenerator(config).UpdateMetadata()
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Metadata Updated: %d\n", updated)
+
+	return nil
+}
+
+// put the generated images together into one image
+func runPreview(args []string) error {
+
+	fs := newFlagSet("preview")
+
+	count := fs.Int("count", 20, "how many images to show, 0 means all")
+	columns := fs.Int("columns", 5, "how many images in a row")
+	size := fs.Int("size", 128, "width of every image in the preview")
+
+	fs.Parse(args)
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	shown, err := newGenerator(config).SavePreview(*count, *columns, *size)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Preview of %d images saved to %s\n", shown, filepath.Join(outputDir, engine.PreviewFileName))
+
+	return nil
+}
+
+// parse ids like '1,5,10-20', nil means all
+func parseIdList(list string) (map[int]bool, error) {
+
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	ids := make(map[int]bool, 0)
+
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+
+		bounds := strings.SplitN(part, "-", 2)
+
+		from, err := strconv.Atoi(bounds[0])
+
+		if err != nil {
+			return nil, fmt.Errorf("wrong id '%s'", part)
+		}
+
+		to := from
+
+		if len(bounds) == 2 {
+			to, err = strconv.Atoi(bounds[1])
+
+			if err != nil || to < from {
+				return nil, fmt.Errorf("wrong id range '%s'", part)
+			}
+		}
+
+		for id := from; id <= to; id++ {
+			ids[id] = true
+		}
+	}
+
+	return ids, nil
+}
@@ -12,7 +12,11 @@ import (
 )
 
 func GetConfig(debug bool) (*models.Config, error) {
-	file, err := os.Open(filepath.Join(".", "conf", "config.json"))
+	return GetConfigFromFile(filepath.Join(".", "conf", "config.json"), debug)
+}
+
+func GetConfigFromFile(path string, debug bool) (*models.Config, error) {
+	file, err := os.Open(path)
 
 	if err != nil {
 		if debug {
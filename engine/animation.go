@@ -0,0 +1,138 @@
+// animation
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"path/filepath"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// frames of an animated layer are kept as one tall image, so the cache treats them like other images
+type layerFrames struct {
+	*image.NRGBA
+	count int
+}
+
+func newLayerFrames(frames []image.Image) (*layerFrames, error) {
+
+	size := frames[0].Bounds().Size()
+
+	sheet := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y*len(frames)))
+
+	for i, f := range frames {
+		if f.Bounds().Size() != size {
+			return nil, fmt.Errorf("frame %d is %dx%d, but the first frame is %dx%d", i+1, f.Bounds().Dx(), f.Bounds().Dy(), size.X, size.Y)
+		}
+
+		draw.Draw(sheet, image.Rect(0, i*size.Y, size.X, (i+1)*size.Y), f, f.Bounds().Min, draw.Src)
+	}
+
+	return &layerFrames{NRGBA: sheet, count: len(frames)}, nil
+}
+
+// still images have one frame
+func getFrameCount(img image.Image) int {
+	if f, ok := img.(*layerFrames); ok {
+		return f.count
+	}
+
+	return 1
+}
+
+// still images are the same in every frame, animated layers with fewer frames start again
+func getLayerFrame(img image.Image, frame int) image.Image {
+
+	f, ok := img.(*layerFrames)
+
+	if !ok {
+		return img
+	}
+
+	var (
+		height = f.Rect.Dy() / f.count
+		i      = frame % f.count
+	)
+
+	return f.SubImage(image.Rect(0, i*height, f.Rect.Dx(), (i+1)*height))
+}
+
+// frames of a frame folder, an animated gif or an animated png, other images have one frame
+func (g *Generator) decodeLayerFrames(path string) ([]image.Image, error) {
+
+	if !isFramesDir(path) {
+		return g.decodeImageFile(path)
+	}
+
+	files, err := g.getFrameFiles(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]image.Image, 0, len(files))
+
+	for _, f := range files {
+		list, err := g.decodeImageFile(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// only the first frame of an animated file is used in a frame folder
+		frames = append(frames, list[0])
+	}
+
+	return frames, nil
+}
+
+// draw the background and the layers of a frame which the variant shows
+func drawEditionFrame(config *models.Config, dna *DNA, images []image.Image, frame int, v models.Variant) *image.RGBA {
+
+	dst := image.NewRGBA(image.Rect(0, 0, config.Format.Width, config.Format.Height))
+
+	if dna.background != nil && variantShows(v, config.Background.TraitName) {
+		dna.background.draw(dst)
+	}
+
+	for i, e := range dna.Elements {
+		if !dna.shows(v, e.BelongLayerName) {
+			continue
+		}
+
+		img := getLayerFrame(images[i], frame)
+
+		rect := dst.Bounds()
+
+		if e.Placement != nil {
+			rect = getPlacementRect(e.Placement, img.Bounds().Size(), rect.Size())
+		}
+
+		utils.DrawBlend(dst, rect, img, img.Bounds().Min, e.BlendMode, e.Opacity)
+	}
+
+	return dst
+}
+
+func (g *Generator) getAnimationPath(id int) string {
+	return filepath.Join(g.outputDir, outputAnimationsDir, getAnimationFileName(id, g.config))
+}
+
+func (g *Generator) saveAnimation(path string, frames []image.Image, animation models.OutputAnimation) error {
+	err := utils.WriteFileAtomic(path, func(w io.Writer) error {
+		return getAnimationFormat(animation).encode(w, frames, animation.Delay, animation.Plays)
+	})
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[CreateAnimation]", err)
+		}
+		return err
+	}
+
+	return nil
+}
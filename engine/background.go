@@ -0,0 +1,233 @@
+// background
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+const (
+	defaultBackgroundTraitName = "Background"
+
+	backgroundSolid  = "solid"
+	backgroundLinear = "linear"
+	backgroundRadial = "radial"
+
+	defaultGradientStops = 2
+)
+
+// what the background of an edition looks like
+type backgroundFill struct {
+	// name of the palette, empty when no palette is used
+	name  string
+	kind  string
+	angle float64
+	stops []color.NRGBA
+}
+
+// palettes are part of the dna, so the same layers with another background is a new nft
+func usePalettes(background models.Background) bool {
+	return background.Generate && len(background.Palettes) > 0
+}
+
+// the color of the background is an attribute by default, so holders can filter by it
+// 背景颜色默认会保存为属性, 方便持有者按背景筛选
+func showBackgroundInMetadata(background models.Background) bool {
+	return background.ShowInMetadata == nil || *background.ShowInMetadata
+}
+
+// the background without palettes, nil if no background is generated.
+// it's picked right after the dna with the same random source, so it can be replayed
+func pickBackground(background models.Background, rng *rand.Rand) *backgroundFill {
+
+	if !background.Generate {
+		return nil
+	}
+
+	if background.Static {
+		return &backgroundFill{kind: backgroundSolid, stops: []color.NRGBA{background.DefaultColor}}
+	}
+
+	c := genColor(rng, background.BrightnessNum)
+
+	return &backgroundFill{kind: backgroundSolid, stops: []color.NRGBA{{c.R, c.G, c.B, c.A}}}
+}
+
+// pick a palette by weight, then the colors of it
+func pickPalette(background models.Background, rng *rand.Rand) *backgroundFill {
+
+	var totalWeight float64 = 0
+
+	for _, p := range background.Palettes {
+		totalWeight += p.Weight
+	}
+
+	var (
+		target  = rng.Float64() * totalWeight
+		palette = background.Palettes[len(background.Palettes)-1]
+	)
+
+	for _, p := range background.Palettes {
+		target -= p.Weight
+
+		if target < 0 {
+			palette = p
+			break
+		}
+	}
+
+	fill := &backgroundFill{
+		name:  palette.Name,
+		kind:  palette.Type,
+		angle: palette.Angle,
+	}
+
+	switch {
+	case len(palette.ColorList) > 0 && palette.Type == backgroundSolid:
+		fill.stops = []color.NRGBA{palette.ColorList[rng.Intn(len(palette.ColorList))]}
+	case len(palette.ColorList) > 0:
+		fill.stops = palette.ColorList
+	default:
+		count := palette.Stops
+
+		if palette.Type == backgroundSolid {
+			count = 1
+		}
+
+		for i := 0; i < count; i++ {
+			hue := rng.Float64()
+			saturation := pickInRange(rng, palette.Saturation) / 100
+			lightness := pickInRange(rng, palette.Lightness) / 100
+
+			c := utils.HSLToRGB(hue, saturation, lightness)
+
+			fill.stops = append(fill.stops, color.NRGBA{c.R, c.G, c.B, c.A})
+		}
+	}
+
+	return fill
+}
+
+// a random number in [min, max]
+func pickInRange(rng *rand.Rand, r []float64) float64 {
+	return r[0] + rng.Float64()*(r[1]-r[0])
+}
+
+func (b *backgroundFill) draw(dst draw.Image) {
+
+	if b.kind == backgroundSolid || len(b.stops) == 1 {
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{b.stops[0]}, image.ZP, draw.Src)
+		return
+	}
+
+	var (
+		bounds = dst.Bounds()
+		width  = float64(bounds.Dx())
+		height = float64(bounds.Dy())
+
+		img = image.NewNRGBA(bounds)
+
+		cos = math.Cos(b.angle * math.Pi / 180)
+		sin = math.Sin(b.angle * math.Pi / 180)
+
+		// a linear gradient goes from corner to corner along the angle,
+		// a radial one from the center to the corners
+		half   = (math.Abs(cos)*width + math.Abs(sin)*height) / 2
+		radius = math.Hypot(width/2, height/2)
+	)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		dy := float64(y) + 0.5 - height/2
+
+		for x := 0; x < bounds.Dx(); x++ {
+			var (
+				dx = float64(x) + 0.5 - width/2
+				t  float64
+			)
+
+			if b.kind == backgroundRadial {
+				t = math.Hypot(dx, dy) / radius
+			} else {
+				t = (dx*cos+dy*sin)/(2*half) + 0.5
+			}
+
+			img.SetNRGBA(bounds.Min.X+x, bounds.Min.Y+y, utils.GradientColor(b.stops, t))
+		}
+	}
+
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+}
+
+// with palettes the name of the palette is a trait like layers,
+// otherwise the color is saved unless background.showInMetadata is off
+func getBackgroundAttribute(config *models.Config, dna *DNA) (models.MetaDataAttribute, bool) {
+
+	if dna.background == nil {
+		return models.MetaDataAttribute{}, false
+	}
+
+	if dna.background.name != "" {
+		return models.MetaDataAttribute{
+			TraitType: config.Background.TraitName,
+			Value:     dna.background.name,
+		}, true
+	}
+
+	if !showBackgroundInMetadata(config.Background) {
+		return models.MetaDataAttribute{}, false
+	}
+
+	return models.MetaDataAttribute{
+		TraitType: config.Background.TraitName,
+		Value:     utils.FormatHexColor(dna.background.stops[0]),
+	}, true
+}
+
+// how many times the combinations of layers are multiplied by the palettes
+func countPalettes(background models.Background) float64 {
+
+	if !usePalettes(background) {
+		return 1
+	}
+
+	var count float64 = 0
+
+	for _, p := range background.Palettes {
+		if p.Weight > 0 {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func (g *Generator) getBrightnessNum(brightness string) (float64, error) {
+	brightness = strings.Replace(brightness, "%", "", -1)
+
+	brightNum, err := strconv.ParseFloat(brightness, 64)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[Background]get color brightness fail: ", err)
+		}
+
+		return 0, err
+	}
+
+	return brightNum / 100, nil
+}
+
+func genColor(rng *rand.Rand, brightness float64) color.RGBA {
+
+	hue := rng.Float64()
+
+	return utils.HSLToRGB(hue, 1, brightness)
+}
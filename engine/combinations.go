@@ -0,0 +1,444 @@
+// combinations
+package engine
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golips_art_engine/models"
+)
+
+// when the editions take more than this rate of the combinations,
+// createDNA will meet duplicates again and again
+const combinationsWarningRate = 0.8
+
+// a counter of the dna a layer configuration can create, the rules may be nil.
+// with rules it also tells createDNA which elements can still lead to a whole dna
+func (g *Generator) newCombinationCounter(c *models.LayerConfiguration, rules *ruleSet) *combinationCounter {
+
+	counter := &combinationCounter{
+		g:               g,
+		layerConfig:     c,
+		rules:           rules,
+		futureNames:     make([]map[string]bool, len(c.LayersOrder)+1),
+		futureLimitKeys: make([]map[string]bool, len(c.LayersOrder)+1),
+		caches:          make(map[string]map[string]models.CombinationCount, 0),
+	}
+
+	// only the conflicts and used elements that later layers care about are kept in the state,
+	// so the same state can be counted once
+	counter.futureNames[len(c.LayersOrder)] = make(map[string]bool, 0)
+	counter.futureLimitKeys[len(c.LayersOrder)] = make(map[string]bool, 0)
+
+	for i := len(c.LayersOrder) - 1; i >= 0; i-- {
+		names := copyBoolMap(counter.futureNames[i+1])
+		limitKeys := copyBoolMap(counter.futureLimitKeys[i+1])
+
+		layer := c.LayersOrder[i]
+
+		for _, e := range layer.Elements {
+			names[e.Name] = true
+		}
+
+		for k, list := range layer.Limits {
+			limitKeys[k] = true
+
+			for _, e := range list {
+				names[e.Name] = true
+			}
+		}
+
+		counter.futureNames[i] = names
+		counter.futureLimitKeys[i] = limitKeys
+	}
+
+	return counter
+}
+
+// count the distinct dna a layer configuration can create, the same way createDNA picks elements.
+// the count is exact unless a bypassDNA layer changes what the later layers can pick,
+// then Min and Max are the bounds of it.
+// 计算一个图层配置可以生成的不同DNA数量, 选取元素的方式与createDNA一致
+func (counter *combinationCounter) count() models.CombinationCount {
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	return counter.countColorBases(0, make(map[string]string, 0), make(map[string]bool, 0))
+}
+
+// whether a whole dna can still be created after the color base of layer i is picked
+func (counter *combinationCounter) canFinishColorBases(i int, colorSets map[string]string, conflictUsed map[string]bool) bool {
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	return counter.countColorBases(i+1, colorSets, conflictUsed).Max > 0
+}
+
+// whether a whole dna can still be created after the element of layer i is picked
+func (counter *combinationCounter) canFinishLayers(i int, colorSets map[string]string, usedElements map[string]bool, conflictUsed map[string]bool) bool {
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.useColorSets(colorSets)
+
+	return counter.countLayers(i+1, usedElements, conflictUsed).Max > 0
+}
+
+// whether the rules and quotas let createDNA pick the color base, and a whole dna can still be created with it.
+// always true for layer configurations without rules and quotas, their counter is nil
+func (counter *combinationCounter) allowsColorBase(i int, layer models.LayerOrder, name string, colorSets map[string]string, conflictUsed map[string]bool) bool {
+
+	if counter == nil {
+		return true
+	}
+
+	nextColorSets := make(map[string]string, len(colorSets)+1)
+
+	for k, color := range colorSets {
+		nextColorSets[k] = color
+	}
+
+	nextColorSets[layer.Options.ColorSet] = name
+
+	// tinted bases pick a color, only the later layers care about it
+	if layer.Options.Tint != nil {
+		return counter.canFinishColorBases(i, nextColorSets, conflictUsed)
+	}
+
+	if counter.banned[counter.g.getLimitKey(layer.Options.DisplayName, name)] || !counter.rules.allows(layer.Options.DisplayName, name, i, true, nil, colorSets) {
+		return false
+	}
+
+	nextConflicts := copyBoolMap(conflictUsed)
+
+	if conflictNames, exist := counter.layerConfig.ConflictElements[name]; exist {
+		addNewConflicts(nextConflicts, conflictNames)
+	}
+
+	return counter.canFinishColorBases(i, nextColorSets, nextConflicts)
+}
+
+// whether the rules and quotas let createDNA pick the element of layer i, and a whole dna can still be created with it.
+// color bases are checked when they are picked, see allowsColorBase
+func (counter *combinationCounter) allowsElement(i int, layer models.LayerOrder, name string, colorSets map[string]string, usedElements map[string]bool, conflictUsed map[string]bool) bool {
+
+	if counter == nil || (layer.Options.IsColorBase && layer.Options.Tint == nil) {
+		return true
+	}
+
+	if counter.banned[counter.g.getLimitKey(layer.Options.DisplayName, name)] || !counter.rules.allows(layer.Options.DisplayName, name, i, false, usedElements, colorSets) {
+		return false
+	}
+
+	nextUsed := copyBoolMap(usedElements)
+	nextUsed[counter.g.getLimitKey(layer.Options.DisplayName, name)] = true
+
+	nextConflicts := copyBoolMap(conflictUsed)
+
+	if conflictNames, exist := counter.layerConfig.ConflictElements[name]; exist {
+		addNewConflicts(nextConflicts, conflictNames)
+	}
+
+	return counter.canFinishLayers(i, colorSets, nextUsed, nextConflicts)
+}
+
+type combinationCounter struct {
+	g           *Generator
+	layerConfig *models.LayerConfiguration
+	rules       *ruleSet
+
+	// every dna has the forced elements and none of the banned ones, they are planned by the quotas.
+	// validateRules forces an element to find the elements the rules never pick
+	forced map[string]bool
+	banned map[string]bool
+
+	// names of elements and keys of limit folders in this layer and the later layers
+	futureNames     []map[string]bool
+	futureLimitKeys []map[string]bool
+
+	colorSets map[string]string
+	cache     map[string]models.CombinationCount
+	// k-v: color sets - cache, createDNA asks with the color sets of every edition
+	caches map[string]map[string]models.CombinationCount
+
+	mutex sync.Mutex
+}
+
+// the states of the layers are counted again for other color sets
+func (counter *combinationCounter) useColorSets(colorSets map[string]string) {
+
+	var keys = make([]string, 0)
+
+	for k, color := range colorSets {
+		keys = append(keys, k+"="+color)
+	}
+
+	sort.Strings(keys)
+
+	key := strings.Join(keys, "\n")
+
+	if counter.caches[key] == nil {
+		counter.caches[key] = make(map[string]models.CombinationCount, 0)
+	}
+
+	counter.colorSets = colorSets
+	counter.cache = counter.caches[key]
+}
+
+// color bases are picked before other layers, see createDNA
+func (counter *combinationCounter) countColorBases(i int, colorSets map[string]string, conflictUsed map[string]bool) models.CombinationCount {
+
+	layers := counter.layerConfig.LayersOrder
+
+	for i < len(layers) && (layers[i].Options.ColorSet == "" || !layers[i].Options.IsColorBase) {
+		i++
+	}
+
+	if i == len(layers) {
+		counter.useColorSets(colorSets)
+
+		return counter.countLayers(0, make(map[string]bool, 0), conflictUsed)
+	}
+
+	var (
+		layer    = layers[i]
+		children = make([]models.CombinationCount, 0)
+		picked   = make(map[string]bool, 0)
+		bases    = layer.Elements
+	)
+
+	// the color of a tinted base comes from the tint palette
+	if layer.Options.Tint != nil {
+		bases = make([]models.LayerElement, 0)
+
+		for _, c := range layer.Options.Tint.Colors {
+			bases = append(bases, models.LayerElement{Name: c.Name, Weight: c.Weight})
+		}
+	}
+
+	for _, v := range bases {
+		if conflictUsed[v.Name] || v.Weight <= 0 || picked[v.Name] {
+			continue
+		}
+
+		if layer.Options.Tint == nil && (counter.banned[counter.g.getLimitKey(layer.Options.DisplayName, v.Name)] || !counter.rules.allows(layer.Options.DisplayName, v.Name, i, true, nil, colorSets)) {
+			continue
+		}
+
+		picked[v.Name] = true
+
+		nextColorSets := make(map[string]string, 0)
+
+		for k, color := range colorSets {
+			nextColorSets[k] = color
+		}
+
+		nextColorSets[layer.Options.ColorSet] = v.Name
+
+		nextConflicts := copyBoolMap(conflictUsed)
+
+		if conflictNames, exist := counter.layerConfig.ConflictElements[v.Name]; exist && layer.Options.Tint == nil {
+			addNewConflicts(nextConflicts, conflictNames)
+		}
+
+		children = append(children, counter.countColorBases(i+1, nextColorSets, nextConflicts))
+	}
+
+	if len(children) == 0 {
+		return counter.countColorBases(i+1, colorSets, conflictUsed)
+	}
+
+	// the base element is in the dna, unless the layer bypasses dna
+	return mergeCombinations(children, !layer.Options.BypassDNA)
+}
+
+func (counter *combinationCounter) countLayers(i int, usedElements map[string]bool, conflictUsed map[string]bool) models.CombinationCount {
+
+	layers := counter.layerConfig.LayersOrder
+
+	if i == len(layers) {
+		if !counter.rules.satisfied(usedElements, counter.colorSets) {
+			return models.CombinationCount{}
+		}
+
+		for k, _ := range counter.forced {
+			if !usedElements[k] {
+				return models.CombinationCount{}
+			}
+		}
+
+		return models.CombinationCount{Min: 1, Max: 1}
+	}
+
+	key := counter.stateKey(i, usedElements, conflictUsed)
+
+	if count, exist := counter.cache[key]; exist {
+		return count
+	}
+
+	var (
+		layer = layers[i]
+		color = ""
+	)
+
+	if layer.Options.ColorSet != "" && !layer.Options.IsColorBase {
+		color = counter.colorSets[layer.Options.ColorSet]
+
+		if color == "" {
+			count := counter.countLayers(i+1, usedElements, conflictUsed)
+			counter.cache[key] = count
+			return count
+		}
+	}
+
+	// tinted images get the color by tinting, not by file names
+	if layer.Options.Tint != nil {
+		color = ""
+	}
+
+	var candidates = make([]models.LayerElement, 0)
+
+	candidates = append(candidates, layer.Elements...)
+
+	for _, k := range getSortedLimitKeys(layer.Limits) {
+		if usedElements[k] {
+			candidates = append(candidates, layer.Limits[k]...)
+		}
+	}
+
+	var (
+		children = make([]models.CombinationCount, 0)
+		// elements with the same name create the same dna
+		picked = make(map[string]bool, 0)
+		// for bypassDNA layers, elements leading to the same state create the same dna
+		states = make(map[string]bool, 0)
+	)
+
+	for _, v := range candidates {
+		if color != "" && v.Color != color {
+			continue
+		}
+
+		if conflictUsed[v.Name] || v.Weight <= 0 || picked[v.Name] || counter.banned[counter.g.getLimitKey(layer.Options.DisplayName, v.Name)] {
+			continue
+		}
+
+		// color bases are checked by the rules when they are picked, see countColorBases
+		if layer.Options.IsColorBase && layer.Options.Tint == nil {
+			if counter.colorSets[layer.Options.ColorSet] != v.Name {
+				continue
+			}
+		} else if !counter.rules.allows(layer.Options.DisplayName, v.Name, i, false, usedElements, counter.colorSets) {
+			continue
+		}
+
+		picked[v.Name] = true
+
+		nextUsed := copyBoolMap(usedElements)
+		nextUsed[counter.g.getLimitKey(layer.Options.DisplayName, v.Name)] = true
+
+		nextConflicts := copyBoolMap(conflictUsed)
+
+		if conflictNames, exist := counter.layerConfig.ConflictElements[v.Name]; exist {
+			addNewConflicts(nextConflicts, conflictNames)
+		}
+
+		if layer.Options.BypassDNA {
+			state := counter.stateKey(i+1, nextUsed, nextConflicts)
+
+			if states[state] {
+				continue
+			}
+
+			states[state] = true
+		}
+
+		child := counter.countLayers(i+1, nextUsed, nextConflicts)
+
+		// every color of a free tint is another dna
+		if tintColors := getFreeTintColors(layer); tintColors != nil && !layer.Options.BypassDNA {
+			child.Min *= float64(len(tintColors))
+			child.Max *= float64(len(tintColors))
+		}
+
+		children = append(children, child)
+	}
+
+	var count models.CombinationCount
+
+	if len(children) == 0 {
+		// nothing can be picked, the layer is just skipped
+		count = counter.countLayers(i+1, usedElements, conflictUsed)
+	} else {
+		count = mergeCombinations(children, !layer.Options.BypassDNA)
+	}
+
+	counter.cache[key] = count
+
+	return count
+}
+
+func (counter *combinationCounter) stateKey(i int, usedElements map[string]bool, conflictUsed map[string]bool) string {
+	var keys = make([]string, 0)
+
+	for k, _ := range usedElements {
+		if counter.futureLimitKeys[i][k] || counter.rules.has(k) || counter.forced[k] {
+			keys = append(keys, "u:"+k)
+		}
+	}
+
+	for k, _ := range conflictUsed {
+		if counter.futureNames[i][k] {
+			keys = append(keys, "c:"+k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return strconv.Itoa(i) + "\n" + strings.Join(keys, "\n")
+}
+
+// distinct children add up, otherwise the dna sets may overlap and only the bounds are known
+func mergeCombinations(children []models.CombinationCount, distinct bool) models.CombinationCount {
+	var count models.CombinationCount
+
+	for _, child := range children {
+		count.Max += child.Max
+
+		if distinct {
+			count.Min += child.Min
+		} else if child.Min > count.Min {
+			count.Min = child.Min
+		}
+	}
+
+	return count
+}
+
+func copyBoolMap(origin map[string]bool) map[string]bool {
+	result := make(map[string]bool, len(origin))
+
+	for k, v := range origin {
+		result[k] = v
+	}
+
+	return result
+}
+
+// limit folders are used in name order, so the same random source always picks the same element
+func getSortedLimitKeys(limits map[string][]models.LayerElement) []string {
+	var keys = make([]string, 0)
+
+	for k, _ := range limits {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
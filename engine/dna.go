@@ -0,0 +1,457 @@
+// dna
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// make sure the program won't last forever, break it if it can not create new dna.
+const maxDnaCheckTimes = 20
+
+var errTooManyDuplicates = errors.New("too many duplicate dna")
+
+// DNA is everything picked for an edition, so it can be rendered and described again
+// DNA包含一个NFT的所有随机选择, 可以再次绘制和生成元数据
+type DNA struct {
+	// index of the layer configuration
+	Batch int
+	// elements of the dna layers joined together, the same key always looks the same
+	Key string
+	// elements in the order of the layers
+	Elements []models.LayerElement
+	// picked after the background with the same random source
+	NumberAttributes []models.MetaDataAttribute
+	// nil if there is no background
+	background *backgroundFill
+	// the only element is the finished image of a one of one, with the attributes of config
+	finished   bool
+	attributes []models.MetaDataAttribute
+}
+
+// Edition is a planned dna with its id
+type Edition struct {
+	Id  int
+	DNA *DNA
+}
+
+// every edition owns its random source, so the result won't depend on goroutine order
+// 每个NFT都有自己的随机源, 这样生成结果不会受协程执行顺序的影响
+func newEditionRand(seed int64, id int) *rand.Rand {
+	return rand.New(rand.NewSource(utils.EditionSeed(seed, id)))
+}
+
+// random sources of a batch which plan its editions
+const (
+	quotaSource = iota
+	oneOfOneSource
+	// ids of all batches are shuffled together, with the source of batch 0
+	idSource
+)
+
+// every batch has its own random sources for planning, negative numbers are never edition ids
+func newBatchRand(seed int64, batch int, source int) *rand.Rand {
+	return rand.New(rand.NewSource(utils.EditionSeed(seed, -1-batch-source<<20)))
+}
+
+// create a new dna for the edition, which is not in the exist dnas
+func (g *Generator) planEdition(id int, batch int, seed int64, counter *combinationCounter, existDNAs map[string]bool) (*Edition, error) {
+
+	var rng = newEditionRand(seed, id)
+
+	for dnaCheckTimes := 0; dnaCheckTimes <= maxDnaCheckTimes; dnaCheckTimes++ {
+		dna := g.createEditionDNA(batch, counter, rng)
+
+		if g.debug {
+			g.log.Printf("DNA FOR %d: %s\n", id, dna.Key)
+		}
+
+		if existDNAs[dna.Key] {
+			continue
+		}
+
+		existDNAs[dna.Key] = true
+
+		g.finishDNA(dna, rng)
+
+		return &Edition{Id: id, DNA: dna}, nil
+	}
+
+	return nil, errTooManyDuplicates
+}
+
+// Replay runs the random source of the edition again until it creates the saved dna,
+// so the background and number attributes will be the same as the first time
+func (g *Generator) Replay(id int, batch int, seed int64, key string) (*Edition, error) {
+
+	if err := g.checkBatch(batch); err != nil {
+		return nil, err
+	}
+
+	// the dna was planned with the id before shuffling
+	planned := g.getPlannedId(id, seed)
+
+	index := planned - g.getFirstId(batch)
+
+	if index < 0 || index >= g.config.LayerConfigurations[batch].GrowEditionSizeTo {
+		return nil, fmt.Errorf("edition %d is not in batch %d", id, batch)
+	}
+
+	oneOfOnes, err := g.getOneOfOneIds(batch, seed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// one of ones are at the same ids as in Plan
+	if i, exist := oneOfOnes[planned]; exist {
+		ed, err := g.createOneOfOne(planned, batch, seed, g.config.LayerConfigurations[batch].OneOfOnes[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ed.DNA.Key != key {
+			return nil, fmt.Errorf("one of one %d has another dna now, please check the seed and the config", id)
+		}
+
+		ed.Id = id
+
+		return ed, nil
+	}
+
+	// the edition gets the same quotas as in Plan
+	plan, err := g.getQuotaPlan(batch, seed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		rng     = newEditionRand(seed, planned)
+		counter = g.getEditionCounter(batch, index, plan)
+	)
+
+	for dnaCheckTimes := 0; dnaCheckTimes <= maxDnaCheckTimes; dnaCheckTimes++ {
+		dna := g.createEditionDNA(batch, counter, rng)
+
+		if dna.Key == key {
+			g.finishDNA(dna, rng)
+
+			return &Edition{Id: id, DNA: dna}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("can not create the dna of %d again, please check the seed and the config", id)
+}
+
+// the dna of the layers, and the background palette in front of it when palettes are used.
+// the counter carries the rules and the quotas of the edition, see createDNA
+func (g *Generator) createEditionDNA(batch int, counter *combinationCounter, rng *rand.Rand) *DNA {
+
+	var (
+		config = g.config
+		dna    = &DNA{Batch: batch}
+	)
+
+	dna.Key, dna.Elements = g.createDNA(&config.LayerConfigurations[batch], counter, rng)
+
+	g.addPalette(dna, rng)
+
+	return dna
+}
+
+// the background palette is in front of the dna of the layers
+func (g *Generator) addPalette(dna *DNA, rng *rand.Rand) {
+
+	var config = g.config
+
+	if !usePalettes(config.Background) {
+		return
+	}
+
+	dna.background = pickPalette(config.Background, rng)
+
+	dnaKeys := []string{g.getLimitKey(config.Background.TraitName, dna.background.name)}
+
+	if dna.Key != "" {
+		dnaKeys = append(dnaKeys, dna.Key)
+	}
+
+	dna.Key = strings.Join(dnaKeys, g.dnaDelimiter)
+}
+
+// the background without palettes and the number attributes are picked after the dna is accepted
+func (g *Generator) finishDNA(dna *DNA, rng *rand.Rand) {
+
+	if !usePalettes(g.config.Background) {
+		dna.background = pickBackground(g.config.Background, rng)
+	}
+
+	dna.NumberAttributes = pickNumberAttributes(g.config.MetadataSettings.NumberAttributes, rng)
+}
+
+func pickNumberAttributes(numberAttributes []models.NumberAttribute, rng *rand.Rand) []models.MetaDataAttribute {
+
+	var list = make([]models.MetaDataAttribute, 0)
+
+	for _, v := range numberAttributes {
+		if (v.MaxValue - v.MinValue) <= 0 {
+			continue
+		}
+
+		list = append(list, models.MetaDataAttribute{
+			DisplayType: "number",
+			TraitType:   v.Name,
+			Value:       rng.Intn(v.MaxValue-v.MinValue) + v.MinValue,
+			MaxValue:    v.MaxValue,
+			MinValue:    v.MinValue,
+		})
+	}
+
+	return list
+}
+
+// pass layer config, the counter is nil unless the layer config has rules or quotas
+func (g *Generator) createDNA(layerConfig *models.LayerConfiguration, counter *combinationCounter, rng *rand.Rand) (string, []models.LayerElement) {
+	var (
+		elementList = make([]models.LayerElement, 0)
+		colorSets   = make(map[string]string, 0)
+		// to find out limit quickly, key is 'layer-element'
+		usedElements = make(map[string]bool, 0)
+		dnaKeys      = make([]string, 0)
+		// key: elements that can not be used due to conflict
+		conflictUsed = make(map[string]bool, 0)
+	)
+
+	// generate color set base first
+	// 首先生成colorset的基础颜色值
+	for i, layer := range layerConfig.LayersOrder {
+		if layer.Options.ColorSet == "" || !layer.Options.IsColorBase {
+			continue
+		}
+
+		// the color of a tinted base comes from the tint palette instead of the elements
+		if layer.Options.Tint != nil {
+			var colors = make([]models.TintColor, 0)
+
+			// colors of weight 0 are not counted, see countColorBases
+			for _, c := range layer.Options.Tint.Colors {
+				if c.Weight > 0 && counter.allowsColorBase(i, layer, c.Name, colorSets, conflictUsed) {
+					colors = append(colors, c)
+				}
+			}
+
+			// like other color bases, the set has no color when nothing can be picked
+			if color, ok := pickTintColor(colors, rng); ok {
+				colorSets[layer.Options.ColorSet] = color.Name
+			}
+
+			continue
+		}
+
+		var (
+			totalWeight float64 = 0
+		)
+
+		var tempElementList = make([]models.LayerElement, 0)
+
+		for _, v := range layer.Elements {
+
+			// check if this element has conflict
+			if conflictUsed[v.Name] {
+				continue
+			}
+
+			// check if the rules allow it
+			if !counter.allowsColorBase(i, layer, v.Name, colorSets, conflictUsed) {
+				continue
+			}
+
+			totalWeight += v.Weight
+			tempElementList = append(tempElementList, v)
+		}
+
+		target := rng.Float64() * totalWeight
+
+		for _, v := range tempElementList {
+			target -= v.Weight
+
+			if target < 0 {
+				// save color set
+
+				conflictNames, exist := layerConfig.ConflictElements[v.Name]
+
+				if exist {
+					addNewConflicts(conflictUsed, conflictNames)
+					if g.debug {
+						g.log.Println("Conflict Added")
+						g.log.Println(conflictUsed)
+					}
+				}
+
+				colorSets[layer.Options.ColorSet] = v.Name
+				break
+			}
+		}
+	}
+
+	for i, layer := range layerConfig.LayersOrder {
+		var (
+			totalWeight float64 = 0
+			color               = ""
+		)
+
+		// check if this layer is in a color set
+		if layer.Options.ColorSet != "" && !layer.Options.IsColorBase {
+			color = colorSets[layer.Options.ColorSet]
+
+			if color == "" {
+				continue
+			}
+		}
+
+		// tinted images get the color by tinting, not by file names
+		if layer.Options.Tint != nil {
+			color = ""
+		}
+
+		var tempElementList = make([]models.LayerElement, 0)
+
+		for _, v := range layer.Elements {
+
+			if color != "" {
+				if v.Color != color {
+					continue
+				}
+			}
+
+			// check if this element has conflict
+			if conflictUsed[v.Name] {
+				continue
+			}
+
+			// check if the rules allow it
+			if !counter.allowsElement(i, layer, v.Name, colorSets, usedElements, conflictUsed) {
+				continue
+			}
+
+			totalWeight += v.Weight
+			tempElementList = append(tempElementList, v)
+		}
+
+		if layer.Limits != nil {
+			for _, k := range getSortedLimitKeys(layer.Limits) {
+				if usedElements[k] {
+					for _, v := range layer.Limits[k] {
+
+						if color != "" {
+							if v.Color != color {
+								continue
+							}
+						}
+
+						// check if this element has conflict
+						if conflictUsed[v.Name] {
+							continue
+						}
+
+						// check if the rules allow it
+						if !counter.allowsElement(i, layer, v.Name, colorSets, usedElements, conflictUsed) {
+							continue
+						}
+
+						totalWeight += v.Weight
+						tempElementList = append(tempElementList, v)
+
+					}
+				}
+			}
+		}
+
+		target := rng.Float64() * totalWeight
+
+		for _, v := range tempElementList {
+
+			// we selected colorset base colors before, so we should pick it directly
+			// 我们已经选择了颜色集合的基底颜色们, 所以这里应该直接选择它们
+			var colorBasePass = false
+
+			if layer.Options.IsColorBase && layer.Options.Tint == nil {
+
+				if colorSets[layer.Options.ColorSet] == v.Name {
+					colorBasePass = true
+				} else {
+					continue
+				}
+			}
+
+			target -= v.Weight
+
+			if target < 0 || colorBasePass {
+				// save layer info in elements to simplify the logic
+				v.BelongLayerName = layer.Options.DisplayName
+				v.HideInMetadata = layer.Options.HideInMetadata
+				v.BlendMode = layer.Options.BlendMode
+				v.Opacity = getLayerOpacity(layer.Options)
+				v.Placement = getElementPlacement(layer, v.Name)
+				v.Tint = getElementTint(layer, colorSets, rng)
+
+				elementList = append(elementList, v)
+
+				dnaKey := g.getLimitKey(layer.Options.DisplayName, v.Name)
+				usedElements[dnaKey] = true
+
+				conflictNames, exist := layerConfig.ConflictElements[v.Name]
+
+				if exist {
+					addNewConflicts(conflictUsed, conflictNames)
+					if g.debug {
+						g.log.Println("Conflict Added")
+						g.log.Println(conflictUsed)
+					}
+				}
+
+				if !layer.Options.BypassDNA {
+					// tinted elements are named like the files of color sets, ie: red$fat
+					if v.Tint != nil {
+						dnaKey = g.getLimitKey(layer.Options.DisplayName, v.Tint.Color.Name+g.colorSetDelimiter+v.Name)
+					}
+
+					dnaKeys = append(dnaKeys, dnaKey)
+				}
+
+				break
+			}
+		}
+	}
+
+	return strings.Join(dnaKeys, g.dnaDelimiter), elementList
+}
+
+func getLayerOpacity(options models.LayerOption) float64 {
+	if options.Opacity == nil {
+		return 1
+	}
+
+	return *options.Opacity
+}
+
+// mark the comma separated conflict elements as used, they can not be picked any more
+func addNewConflicts(origin map[string]bool, newC string) {
+
+	conflictNames := strings.Split(newC, ",")
+
+	for _, v := range conflictNames {
+		origin[v] = true
+	}
+}
+
+func (g *Generator) getLimitKey(layerName string, elementName string) string {
+	return fmt.Sprintf("%s%s%s", layerName, g.limitDelimiter, elementName)
+}
@@ -0,0 +1,255 @@
+// engine
+
+// Package engine creates the dna, the images and the metadata of a collection from a config,
+// the command line tool is a thin wrapper around it.
+// 根据配置生成整个系列的DNA, 图片和元数据, 命令行工具只是对它的简单封装
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math/rand"
+	"sync"
+
+	"golips_art_engine/cache"
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+const (
+	outputImagesDir      = "images"
+	outputMetadataDir    = "json"
+	outputSolMetadataDir = "json-sol"
+	outputAnimationsDir  = "animations"
+	outputRasterDir      = "images-raster"
+
+	// extension of frame folders
+	framesDirExt = ".frames"
+
+	// files in the output folder
+	DnaHistoryFileName = "dna-history.json"
+	BuildInfoFileName  = "build-info.json"
+	RarityFileName     = "rarity.json"
+	// the rarity of every batch, %d is the batch from 1
+	BatchRarityFileName = "batch-%d-rarity.json"
+	PreviewFileName     = "preview.png"
+
+	defaultRarityDelimiter   = "#"
+	defaultColorSetDelimiter = "$"
+	defaultLimitDelimiter    = "^"
+	defaultDnaDelimiter      = "-"
+)
+
+var errNotValidated = errors.New("the config is not validated, please call Validate and fix the problems first")
+
+// Options are the folders of a generator, relative paths are relative to the working directory
+type Options struct {
+	// folder of the layers
+	LayersDir string
+	// folder of the generated files
+	OutputDir string
+	// path of the config file, only used in the messages of problems
+	ConfigPath string
+	// nil means the standard logger
+	Logger *log.Logger
+}
+
+// Generator creates the editions of a config, every generator has its own folders, cache and logger.
+// Validate reads the layers into the config, it should be called before anything is created
+// 每个生成器都有自己的文件夹, 缓存和日志, 生成之前需要先调用Validate
+type Generator struct {
+	config *models.Config
+
+	debug bool
+	log   *log.Logger
+
+	configPath string
+	layersDir  string
+	outputDir  string
+
+	rarityDelimiter   string
+	colorSetDelimiter string
+	limitDelimiter    string
+	dnaDelimiter      string
+
+	// decoded layer images shared by all the workers
+	layerCache *cache.ImageCache
+
+	// svg layers are read once, every edition puts them into its document again
+	// k-v: path - *utils.SVGFragment
+	svgFragments sync.Map
+
+	// counters of the layer configurations with rules, nil for the others
+	counters []*combinationCounter
+
+	// quotas of the layer configurations, nil for the ones without quotas
+	quotas []*quotaSet
+	// planned quotas of the last seed, see getQuotaPlan
+	quotaPlans []*quotaPlan
+	quotaMutex sync.Mutex
+
+	// k-v: final id - planned id of the shuffled ids of the last seed, see getPlannedId
+	plannedIds map[int]int
+	idSeed     int64
+	idMutex    sync.Mutex
+
+	// set by Validate when no problem is found
+	validated bool
+}
+
+// New creates a generator of the config, nothing is read until Validate
+func New(config *models.Config, options Options) *Generator {
+
+	g := &Generator{
+		config:            config,
+		debug:             config.LogSettings.Debug,
+		log:               options.Logger,
+		configPath:        options.ConfigPath,
+		layersDir:         options.LayersDir,
+		outputDir:         options.OutputDir,
+		rarityDelimiter:   defaultRarityDelimiter,
+		colorSetDelimiter: defaultColorSetDelimiter,
+		limitDelimiter:    defaultLimitDelimiter,
+		dnaDelimiter:      defaultDnaDelimiter,
+		layerCache:        cache.New(int64(config.CacheSettings.MemoryLimit) * 1024 * 1024),
+	}
+
+	if g.log == nil {
+		g.log = log.Default()
+	}
+
+	if config.RarityDelimiter != "" {
+		g.rarityDelimiter = config.RarityDelimiter
+	}
+
+	if config.ColorSetDelimiter != "" {
+		g.colorSetDelimiter = config.ColorSetDelimiter
+	}
+
+	if config.LimitDelimiter != "" {
+		g.limitDelimiter = config.LimitDelimiter
+	}
+
+	if config.DnaDelimiter != "" {
+		g.dnaDelimiter = config.DnaDelimiter
+	}
+
+	return g
+}
+
+// Config is the config of the generator, the elements of the layers are in it after Validate
+func (g *Generator) Config() *models.Config {
+	return g.config
+}
+
+// GenerateDNA picks the elements, the background and the number attributes of a batch with the random source.
+// duplicates and quotas are not checked, Plan does it across the whole collection
+func (g *Generator) GenerateDNA(batch int, rng *rand.Rand) (*DNA, error) {
+
+	if err := g.checkBatch(batch); err != nil {
+		return nil, err
+	}
+
+	// quotas are planned for the editions of a whole batch, they don't apply to a single dna
+	dna := g.createEditionDNA(batch, g.counters[batch], rng)
+
+	g.finishDNA(dna, rng)
+
+	return dna, nil
+}
+
+// Render draws the still image of the dna, the main image without the multi-version layer.
+// svg documents are rasterized at the size of the canvas
+func (g *Generator) Render(dna *DNA) (image.Image, error) {
+
+	if err := g.checkBatch(dna.Batch); err != nil {
+		return nil, err
+	}
+
+	if g.config.Format.Type == formatSvg {
+		doc, err := g.buildEditionSvg(dna, getMainVariant(g.config))
+
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := utils.RasterizeSVG(doc, g.config.Format.Width, g.config.Format.Height)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return img, nil
+	}
+
+	images, _, err := g.loadEditionImages(dna)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return drawEditionFrame(g.config, dna, images, 0, getMainVariant(g.config)), nil
+}
+
+// Metadata is the erc721 metadata of the edition, like the file Generate writes.
+// metadataSettings.extraMetadata is not in it, it's only merged into the file
+func (g *Generator) Metadata(id int, dna *DNA) (*models.MetadataErc721, error) {
+
+	if err := g.checkBatch(dna.Batch); err != nil {
+		return nil, err
+	}
+
+	animated, err := g.isAnimated(dna)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := getMetadataErc721(id, dna, g.config, animated)
+	metadata.ExtraMetadata = ""
+
+	return metadata, nil
+}
+
+// MetadataSolana is the solana metadata of the edition, see Metadata
+func (g *Generator) MetadataSolana(id int, dna *DNA) (*models.MetadataSolana, error) {
+
+	if err := g.checkBatch(dna.Batch); err != nil {
+		return nil, err
+	}
+
+	animated, err := g.isAnimated(dna)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := getMetadataSolana(id, dna, g.config, animated)
+	metadata.ExtraMetadata = ""
+
+	return metadata, nil
+}
+
+// nothing can be created before the layers are read
+func (g *Generator) checkBatch(batch int) error {
+
+	if !g.validated {
+		return errNotValidated
+	}
+
+	if batch < 0 || batch >= len(g.config.LayerConfigurations) {
+		return fmt.Errorf("batch %d is not in the config", batch)
+	}
+
+	return nil
+}
+
+func getMultiVersionFolderName(layerName string) string {
+	return outputImagesDir + "-" + layerName
+}
+
+func getResolutionFolderName(name string) string {
+	return outputImagesDir + "-" + name
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golips_art_engine/models"
+)
+
+// every test layer has 4 elements of weight 10, 1x1 transparent pngs are enough for planning
+var testLayers = map[string][]string{
+	"Body": {"gold", "silver", "bronze", "wood"},
+	"Hat":  {"crown", "cap", "beanie", "halo"},
+	"Eyes": {"laser", "plain", "sleepy", "wink"},
+}
+
+// config of the tests, layerConfigurations and dnaSettings are json like in config.json
+func newTestConfig(t *testing.T, layerConfigurations string, dnaSettings string) *models.Config {
+	t.Helper()
+
+	var config = &models.Config{}
+
+	src := fmt.Sprintf(`{
+		"format": {"width": 1, "height": 1},
+		"background": {"generate": false},
+		"metadataSettings": {"numberAttributes": [{"name": "power", "minValue": 0, "maxValue": 100}]},
+		"dnaSettings": %s,
+		"layerConfigurations": %s
+	}`, dnaSettings, layerConfigurations)
+
+	if err := json.Unmarshal([]byte(src), config); err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+// a generator over a temp layers folder, the problems of Validate are returned
+func newTestGenerator(t *testing.T, config *models.Config) (*Generator, ProblemList) {
+	t.Helper()
+
+	return newTestGeneratorWithLayers(t, config, testLayers)
+}
+
+// like newTestGenerator, with other layers. k-v: layer - element file names without '#10.png'
+func newTestGeneratorWithLayers(t *testing.T, config *models.Config, layers map[string][]string) (*Generator, ProblemList) {
+	t.Helper()
+
+	g := newUnvalidatedTestGenerator(t, config, layers)
+
+	problems, _ := g.Validate()
+
+	return g, problems
+}
+
+// a generator over a temp layers folder, Validate is not called yet
+func newUnvalidatedTestGenerator(t *testing.T, config *models.Config, layers map[string][]string) *Generator {
+	t.Helper()
+
+	var dir = t.TempDir()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+
+	for layer, names := range layers {
+		if err := os.MkdirAll(filepath.Join(dir, layer), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range names {
+			f, err := os.Create(filepath.Join(dir, layer, name+"#10.png"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			png.Encode(f, img)
+			f.Close()
+		}
+	}
+
+	g := New(config, Options{
+		LayersDir:  dir,
+		OutputDir:  filepath.Join(dir, "build"),
+		ConfigPath: "config.json",
+		Logger:     log.New(ioutil.Discard, "", 0),
+	})
+
+	return g
+}
+
+// a validated generator, the test fails with the problems
+func mustTestGenerator(t *testing.T, config *models.Config) *Generator {
+	t.Helper()
+
+	g, problems := newTestGenerator(t, config)
+
+	if len(problems) > 0 {
+		t.Fatalf("config problems:\n%s", problems)
+	}
+
+	return g
+}
+
+// k-v: 'layer^element' - editions having it
+func countTestElements(editions []*Edition) map[string]int {
+
+	var counts = make(map[string]int, 0)
+
+	for _, ed := range editions {
+		for _, v := range ed.DNA.Elements {
+			counts[v.BelongLayerName+"^"+v.Name]++
+		}
+	}
+
+	return counts
+}
+
+func hasTestElement(ed *Edition, key string) bool {
+
+	for _, v := range ed.DNA.Elements {
+		if v.BelongLayerName+"^"+v.Name == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+const testLayersOrder = `[{"name": "Body"}, {"name": "Hat"}, {"name": "Eyes"}]`
+
+// Replay of every planned edition gives the same dna, background and number attributes
+func assertReplay(t *testing.T, g *Generator, seed int64, editions []*Edition) {
+	t.Helper()
+
+	for _, ed := range editions {
+		replayed, err := g.Replay(ed.Id, ed.DNA.Batch, seed, ed.DNA.Key)
+
+		if err != nil {
+			t.Fatalf("replay %d: %s", ed.Id, err)
+		}
+
+		if replayed.Id != ed.Id || replayed.DNA.Key != ed.DNA.Key {
+			t.Fatalf("replay %d: got %d '%s', want '%s'", ed.Id, replayed.Id, replayed.DNA.Key, ed.DNA.Key)
+		}
+
+		if fmt.Sprint(replayed.DNA.NumberAttributes) != fmt.Sprint(ed.DNA.NumberAttributes) {
+			t.Fatalf("replay %d: number attributes %v, want %v", ed.Id, replayed.DNA.NumberAttributes, ed.DNA.NumberAttributes)
+		}
+	}
+}
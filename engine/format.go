@@ -0,0 +1,125 @@
+// format
+package engine
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+const (
+	formatPng  = "png"
+	formatJpeg = "jpeg"
+	formatWebp = "webp"
+	formatSvg  = "svg"
+
+	svgExt = ".svg"
+
+	// the biggest size of webp images
+	webpMaxSize = 16384
+
+	animationGif  = "gif"
+	animationApng = "apng"
+
+	// milliseconds of every frame
+	defaultAnimationDelay = 100
+)
+
+type imageFormat struct {
+	ext      string
+	mimeType string
+	encode   func(w io.Writer, img image.Image, format models.OutputFormat) error
+}
+
+// k-v: format.type - format
+var imageFormats = map[string]imageFormat{
+	formatPng: {
+		ext:      ".png",
+		mimeType: "image/png",
+		encode: func(w io.Writer, img image.Image, format models.OutputFormat) error {
+			encoder := png.Encoder{CompressionLevel: pngCompressionLevels[format.Compression]}
+			return encoder.Encode(w, img)
+		},
+	},
+	formatJpeg: {
+		ext:      ".jpg",
+		mimeType: "image/jpeg",
+		encode: func(w io.Writer, img image.Image, format models.OutputFormat) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: format.Quality})
+		},
+	},
+	formatWebp: {
+		ext:      ".webp",
+		mimeType: "image/webp",
+		encode: func(w io.Writer, img image.Image, format models.OutputFormat) error {
+			return utils.EncodeWebP(w, img)
+		},
+	},
+	// svg documents are built from the layer files, see saveSvgEdition
+	formatSvg: {
+		ext:      svgExt,
+		mimeType: "image/svg+xml",
+		encode: func(w io.Writer, img image.Image, format models.OutputFormat) error {
+			return errors.New("svg can not be encoded from images")
+		},
+	},
+}
+
+// k-v: format.compression - png compression level
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// png if the type is not set
+func getImageFormat(format models.OutputFormat) imageFormat {
+	if f, ok := imageFormats[format.Type]; ok {
+		return f
+	}
+
+	return imageFormats[formatPng]
+}
+
+// the raster export of svg documents, saved like other images
+func getRasterFormat(format models.OutputFormat) models.OutputFormat {
+	format.Type = format.Raster
+
+	return format
+}
+
+type animationFormat struct {
+	ext      string
+	mimeType string
+	encode   func(w io.Writer, frames []image.Image, delay int, plays int) error
+}
+
+// k-v: format.animation.type - format
+var animationFormats = map[string]animationFormat{
+	animationGif: {
+		ext:      ".gif",
+		mimeType: "image/gif",
+		encode:   utils.EncodeGIF,
+	},
+	animationApng: {
+		ext:      ".png",
+		mimeType: "image/apng",
+		encode:   utils.EncodeAPNG,
+	},
+}
+
+// gif if the type is not set
+func getAnimationFormat(animation models.OutputAnimation) animationFormat {
+	if f, ok := animationFormats[animation.Type]; ok {
+		return f
+	}
+
+	return animationFormats[animationGif]
+}
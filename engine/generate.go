@@ -0,0 +1,291 @@
+// generate
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golips_art_engine/models"
+)
+
+// Plan creates the dna of every edition which is not in the exist dnas, and counts the traits of them.
+// every dna is created before anything is rendered, so a failure leaves the old build as it is
+// 所有DNA都在渲染之前生成, 失败时不会影响旧的生成结果
+func (g *Generator) Plan(seed int64, existDNAs map[string]bool) ([]*Edition, error) {
+
+	if !g.validated {
+		return nil, errNotValidated
+	}
+
+	var (
+		config   = g.config
+		editions = make([]*Edition, 0)
+	)
+
+	oneOfOnes, err := g.planOneOfOnes(seed, existDNAs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for batch, _ := range config.LayerConfigurations {
+
+		c := &config.LayerConfigurations[batch]
+
+		if config.LogSettings.ShowGeneratingProgress {
+			g.log.Println("Generating batch: ", batch)
+		}
+
+		// quotas are planned for the whole batch before its first dna
+		plan, err := g.getQuotaPlan(batch, seed)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s in the quotas of batch %d", err, batch)
+		}
+
+		for i := 1; i <= c.GrowEditionSizeTo; i++ {
+
+			// -1 is because the i start at 1
+			num := g.getFirstId(batch) + i - 1
+
+			// traits of one of ones are counted too
+			if ed, exist := oneOfOnes[num]; exist {
+				countEditionTraits(config, c, ed.DNA)
+
+				editions = append(editions, ed)
+				continue
+			}
+
+			// dna is created in order before rendering, so duplicates are always resolved the same way
+			// DNA在渲染前按顺序生成, 保证重复DNA的处理结果每次都一致
+			ed, err := g.planEdition(num, batch, seed, g.getEditionCounter(batch, i-1, plan), existDNAs)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s at edition %d of batch %d, only %d of %d dna created. Please make sure traits have enough amount", err, num, batch, len(editions), getEditionCount(config))
+			}
+
+			countEditionTraits(config, c, ed.DNA)
+
+			editions = append(editions, ed)
+		}
+	}
+
+	// every dna is planned with the id in order, then the editions of all batches are mixed up,
+	// so the ids don't tell which batch an edition comes from
+	// 所有DNA按顺序规划之后再打乱所有批次的编号, 这样就无法通过编号看出NFT属于哪个批次
+	if config.DnaSettings.ShuffleIds {
+		ids := g.getShuffledIds(seed)
+
+		for _, ed := range editions {
+			ed.Id = ids[ed.Id]
+		}
+	}
+
+	return editions, nil
+}
+
+// the final ids of the planned ids, one of ones with the id set in config keep it.
+// k-v: planned id - final id
+func (g *Generator) getShuffledIds(seed int64) map[int]int {
+
+	var (
+		config  = g.config
+		planned = make([]int, 0)
+		ids     = make(map[int]int, 0)
+	)
+
+	for batch, c := range config.LayerConfigurations {
+		var fixed = make(map[int]bool, 0)
+
+		for _, o := range c.OneOfOnes {
+			if o.Id != 0 {
+				fixed[o.Id] = true
+			}
+		}
+
+		for i := 0; i < c.GrowEditionSizeTo; i++ {
+			id := g.getFirstId(batch) + i
+
+			if fixed[id] {
+				ids[id] = id
+				continue
+			}
+
+			planned = append(planned, id)
+		}
+	}
+
+	rng := newBatchRand(seed, 0, idSource)
+
+	for i, j := range rng.Perm(len(planned)) {
+		ids[planned[i]] = planned[j]
+	}
+
+	return ids
+}
+
+// the id an edition was planned with, the shuffled ids are inverted once for every seed,
+// so replaying the whole collection doesn't shuffle it again for every edition
+func (g *Generator) getPlannedId(id int, seed int64) int {
+
+	if !g.config.DnaSettings.ShuffleIds {
+		return id
+	}
+
+	g.idMutex.Lock()
+	defer g.idMutex.Unlock()
+
+	if g.plannedIds == nil || g.idSeed != seed {
+		g.plannedIds = make(map[int]int, 0)
+
+		for planned, final := range g.getShuffledIds(seed) {
+			g.plannedIds[final] = planned
+		}
+
+		g.idSeed = seed
+	}
+
+	if planned, exist := g.plannedIds[id]; exist {
+		return planned
+	}
+
+	return id
+}
+
+// id of the first edition of the batch, the start id of the batch if it has been set,
+// otherwise ids go on after the batch before it, the first batch starts from dnaSettings.startId.
+// 批次设置了startId时从它开始编号, 否则接着上一个批次的最后一个编号
+func (g *Generator) getFirstId(batch int) int {
+
+	var config = g.config
+
+	if start := config.LayerConfigurations[batch].StartId; start > 0 {
+		return start
+	}
+
+	if batch > 0 {
+		return g.getFirstId(batch-1) + config.LayerConfigurations[batch-1].GrowEditionSizeTo
+	}
+
+	if config.DnaSettings.StartId > 0 {
+		return config.DnaSettings.StartId
+	}
+
+	return 1
+}
+
+func getEditionCount(config *models.Config) int {
+	var count = 0
+
+	for _, c := range config.LayerConfigurations {
+		count += c.GrowEditionSizeTo
+	}
+
+	return count
+}
+
+// CreateOutputFolders creates the folders of the output, the files in them are kept
+func (g *Generator) CreateOutputFolders() error {
+
+	var (
+		config  = g.config
+		folders = []string{outputImagesDir, outputMetadataDir}
+	)
+
+	if config.MetadataSettings.OutputSOLFormat {
+		folders = append(folders, outputSolMetadataDir)
+	}
+
+	for _, v := range getVariants(config) {
+		folders = append(folders, getMultiVersionFolderName(v.Name))
+	}
+
+	for _, r := range config.Format.Resolutions {
+		folders = append(folders, getResolutionFolderName(r.Name))
+	}
+
+	if config.Format.Animation.Type != "" {
+		folders = append(folders, outputAnimationsDir)
+	}
+
+	if config.Format.Raster != "" {
+		folders = append(folders, outputRasterDir)
+	}
+
+	for _, folder := range folders {
+		err := os.MkdirAll(filepath.Join(g.outputDir, folder), os.ModePerm)
+
+		if err != nil {
+			if g.debug {
+				g.log.Println("[CreateFolder]", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveRarityFiles saves the traits counted by Plan, one file for every batch.
+// the rarity file of the whole collection is saved by UpdateRarity
+func (g *Generator) SaveRarityFiles() error {
+
+	for batch, c := range g.config.LayerConfigurations {
+		err := g.saveRarityFile(batch, c.Traits)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// traits of the edition, finished images count their own attributes. number attributes are not traits
+func countEditionTraits(config *models.Config, layerConfig *models.LayerConfiguration, dna *DNA) {
+
+	if dna.finished {
+		for _, attr := range dna.attributes {
+			if attr.DisplayType == "" {
+				countTrait(layerConfig, attr)
+			}
+		}
+
+		return
+	}
+
+	countTraits(layerConfig, dna.Elements)
+
+	if attr, ok := getBackgroundAttribute(config, dna); ok {
+		countTrait(layerConfig, attr)
+	}
+}
+
+// traits which are not layers, such as the background
+func countTrait(layerConfig *models.LayerConfiguration, attr models.MetaDataAttribute) {
+	if layerConfig.Traits[attr.TraitType] == nil {
+		layerConfig.Traits[attr.TraitType] = make(map[string]int, 0)
+	}
+
+	layerConfig.Traits[attr.TraitType][fmt.Sprint(attr.Value)] += 1
+}
+
+func countTraits(layerConfig *models.LayerConfiguration, elements []models.LayerElement) {
+	for _, e := range elements {
+
+		if e.HideInMetadata {
+			continue
+		}
+
+		traits, ok := layerConfig.Traits[e.BelongLayerName]
+
+		if ok {
+			traits[e.Name] += 1
+		}
+
+		if attr, ok := getTintAttribute(e); ok {
+			countTrait(layerConfig, attr)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func getTestIds(editions []*Edition) []int {
+
+	var ids = make([]int, 0, len(editions))
+
+	for _, ed := range editions {
+		ids = append(ids, ed.Id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func TestPlanShuffleIds(t *testing.T) {
+
+	var layerConfigurations = `[
+		{"growEditionSizeTo": 6, "layersOrder": ` + testLayersOrder + `, "oneOfOnes": [{"id": 4, "elements": ["Hat^crown"]}]},
+		{"growEditionSizeTo": 6, "layersOrder": ` + testLayersOrder + `}
+	]`
+
+	var (
+		ordered  = mustTestGenerator(t, newTestConfig(t, layerConfigurations, `{"startId": 1}`))
+		shuffled = mustTestGenerator(t, newTestConfig(t, layerConfigurations, `{"startId": 1, "shuffleIds": true}`))
+	)
+
+	for seed := int64(1); seed <= 5; seed++ {
+		want, err := ordered.Plan(seed, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := shuffled.Plan(seed, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the same dna in the same planning order, only the ids are moved
+		var moved = false
+
+		for i := range want {
+			if got[i].DNA.Key != want[i].DNA.Key {
+				t.Fatalf("seed %d: edition %d has another dna when shuffled", seed, want[i].Id)
+			}
+
+			if got[i].Id != want[i].Id {
+				moved = true
+			}
+
+			// one of ones with an id keep it
+			if want[i].Id == 4 && got[i].Id != 4 {
+				t.Errorf("seed %d: the one of one at id 4 is moved to %d", seed, got[i].Id)
+			}
+		}
+
+		if !moved {
+			t.Errorf("seed %d: no id is shuffled", seed)
+		}
+
+		for i, id := range getTestIds(got) {
+			if id != i+1 {
+				t.Fatalf("seed %d: shuffled ids %v, want 1 ~ 12", seed, getTestIds(got))
+			}
+		}
+
+		assertReplay(t, shuffled, seed, got)
+
+		// the same seed always gives the same ids
+		again, _ := shuffled.Plan(seed, make(map[string]bool, 0))
+
+		for i := range again {
+			if again[i].Id != got[i].Id {
+				t.Fatalf("seed %d: ids are shuffled another way", seed)
+			}
+		}
+	}
+}
+
+func TestPlanBatchIds(t *testing.T) {
+
+	var cases = []struct {
+		name                string
+		layerConfigurations string
+		dnaSettings         string
+		want                []int
+	}{
+		{
+			name: "running total",
+			layerConfigurations: `[
+				{"growEditionSizeTo": 5, "layersOrder": ` + testLayersOrder + `},
+				{"count": 4, "layersOrder": ` + testLayersOrder + `},
+				{"growEditionSizeTo": 3, "layersOrder": ` + testLayersOrder + `, "oneOfOnes": [{"id": 10, "elements": ["Hat^crown"]}]}
+			]`,
+			dnaSettings: `{"startId": 1}`,
+			want:        []int{1, 12},
+		},
+		{
+			name: "start ids",
+			layerConfigurations: `[
+				{"growEditionSizeTo": 5, "layersOrder": ` + testLayersOrder + `},
+				{"startId": 1000, "count": 4, "layersOrder": ` + testLayersOrder + `, "oneOfOnes": [{"id": 1002, "elements": ["Hat^crown"]}]},
+				{"growEditionSizeTo": 3, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			dnaSettings: `{"startId": 100}`,
+			want:        []int{100, 104, 1000, 1006},
+		},
+		{
+			name: "start ids shuffled",
+			layerConfigurations: `[
+				{"growEditionSizeTo": 5, "layersOrder": ` + testLayersOrder + `},
+				{"startId": 1000, "count": 4, "layersOrder": ` + testLayersOrder + `, "oneOfOnes": [{"id": 1002, "elements": ["Hat^crown"]}]},
+				{"growEditionSizeTo": 3, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			dnaSettings: `{"startId": 100, "shuffleIds": true}`,
+			want:        []int{100, 104, 1000, 1006},
+		},
+	}
+
+	for _, c := range cases {
+		g := mustTestGenerator(t, newTestConfig(t, c.layerConfigurations, c.dnaSettings))
+
+		editions, err := g.Plan(1, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		// ids are unique and contiguous in the ranges of want
+		var want = make([]int, 0)
+
+		for i := 0; i < len(c.want); i += 2 {
+			for id := c.want[i]; id <= c.want[i+1]; id++ {
+				want = append(want, id)
+			}
+		}
+
+		got := getTestIds(editions)
+
+		if len(got) != len(want) {
+			t.Fatalf("%s: ids %v, want %v", c.name, got, want)
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: ids %v, want %v", c.name, got, want)
+			}
+		}
+
+		// one of ones keep their ids in every batch, and every id stays in its own batch unless shuffled
+		for _, ed := range editions {
+			first := g.getFirstId(ed.DNA.Batch)
+
+			if !g.config.DnaSettings.ShuffleIds && (ed.Id < first || ed.Id >= first+g.config.LayerConfigurations[ed.DNA.Batch].GrowEditionSizeTo) {
+				t.Errorf("%s: id %d is out of batch %d", c.name, ed.Id, ed.DNA.Batch)
+			}
+
+			if (ed.Id == 10 || ed.Id == 1002) && !hasTestElement(ed, "Hat^crown") {
+				t.Errorf("%s: the one of one at %d is moved", c.name, ed.Id)
+			}
+		}
+
+		assertReplay(t, g, 1, editions)
+	}
+}
+
+func TestBatchIdProblems(t *testing.T) {
+
+	var cases = []struct {
+		name                string
+		layerConfigurations string
+		problem             string
+	}{
+		{
+			name: "overlap",
+			layerConfigurations: `[
+				{"growEditionSizeTo": 5, "layersOrder": ` + testLayersOrder + `},
+				{"growEditionSizeTo": 4, "layersOrder": ` + testLayersOrder + `},
+				{"startId": 3, "growEditionSizeTo": 3, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			problem: "layerConfigurations[2].startId: ids 3 ~ 5 overlap the ids 1 ~ 5 of layerConfigurations[0]",
+		},
+		{
+			name: "overlap after a start id",
+			layerConfigurations: `[
+				{"startId": 20, "growEditionSizeTo": 5, "layersOrder": ` + testLayersOrder + `},
+				{"growEditionSizeTo": 4, "layersOrder": ` + testLayersOrder + `},
+				{"startId": 27, "growEditionSizeTo": 3, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			problem: "layerConfigurations[2].startId: ids 27 ~ 29 overlap the ids 25 ~ 28 of layerConfigurations[1]",
+		},
+		{
+			name: "count and growEditionSizeTo",
+			layerConfigurations: `[
+				{"count": 5, "growEditionSizeTo": 4, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			problem: "layerConfigurations[0].count: 5 is not the 4 of growEditionSizeTo",
+		},
+		{
+			name: "negative start id",
+			layerConfigurations: `[
+				{"startId": -1, "count": 5, "layersOrder": ` + testLayersOrder + `}
+			]`,
+			problem: "layerConfigurations[0].startId: should not be negative",
+		},
+		{
+			name: "no count",
+			layerConfigurations: `[
+				{"layersOrder": ` + testLayersOrder + `}
+			]`,
+			problem: "layerConfigurations[0].growEditionSizeTo: should be greater than 0",
+		},
+	}
+
+	for _, c := range cases {
+		_, problems := newTestGenerator(t, newTestConfig(t, c.layerConfigurations, `{}`))
+
+		if !strings.Contains(problems.Error(), c.problem) {
+			t.Errorf("%s: problems\n%s\nwant '%s'", c.name, problems, c.problem)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// history
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"golips_art_engine/models"
+)
+
+// SaveBuildInfo saves the info of the build to the output folder
+func (g *Generator) SaveBuildInfo(info models.BuildInfo) error {
+	return g.saveJsonFile(filepath.Join(g.outputDir, BuildInfoFileName), &info)
+}
+
+// LoadBuildInfo reads the info saved by SaveBuildInfo
+func (g *Generator) LoadBuildInfo() (*models.BuildInfo, error) {
+	var info models.BuildInfo
+
+	body, err := ioutil.ReadFile(filepath.Join(g.outputDir, BuildInfoFileName))
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadFile]", err)
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &info)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[JsonUnmarshal]", err)
+		}
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// SaveDnaHistory saves the dna of the editions to the output folder, in the order of the ids
+func (g *Generator) SaveDnaHistory(editions []*Edition) error {
+
+	var history = make([]models.DnaHistoryItem, 0)
+
+	for _, ed := range editions {
+		history = append(history, models.DnaHistoryItem{
+			Dna:     ed.DNA.Key,
+			Edition: ed.Id,
+			Batch:   ed.DNA.Batch,
+		})
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Edition < history[j].Edition
+	})
+
+	return g.saveJsonFile(filepath.Join(g.outputDir, DnaHistoryFileName), &history)
+}
+
+// LoadDnaHistory reads a dna history file, the path is not relative to the output folder
+func (g *Generator) LoadDnaHistory(name string) ([]models.DnaHistoryItem, error) {
+	var history = make([]models.DnaHistoryItem, 0)
+
+	body, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadFile]", err)
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &history)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[JsonUnmarshal]", err)
+		}
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -0,0 +1,220 @@
+// layers
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golips_art_engine/models"
+)
+
+// read elements of every layer, all the problems of file names are returned together.
+// missing layer folders are skipped here, Validate reports them with the field name
+func (g *Generator) layersSetup(layer *models.LayerConfiguration) error {
+
+	var problems ProblemList
+
+	layer.Traits = make(map[string]map[string]int, 0)
+
+	for i, v := range layer.LayersOrder {
+
+		if v.Options.DisplayName == "" {
+			layer.LayersOrder[i].Options.DisplayName = v.Name
+		}
+
+		dir := filepath.Join(g.layersDir, v.Name)
+
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+
+		list, limits, err := g.getElementsFromDir(dir, v.Options.ColorSet != "", 0)
+
+		if err != nil {
+			problems.addError(err)
+		}
+
+		layer.LayersOrder[i].Elements = list
+		layer.LayersOrder[i].Limits = limits
+
+		// ignore traits if layer shoule be hide in metedata
+		if v.Options.HideInMetadata {
+			continue
+		}
+
+		traits := make(map[string]int, 0)
+
+		for _, e := range list {
+			traits[e.Name] = 0
+		}
+
+		for _, le := range limits {
+			for _, e := range le {
+				traits[e.Name] = 0
+			}
+		}
+
+		layer.Traits[layer.LayersOrder[i].Options.DisplayName] = traits
+	}
+
+	return problems.err()
+}
+
+func (g *Generator) getElementsFromDir(dir string, isColorSet bool, startId int) ([]models.LayerElement, map[string][]models.LayerElement, error) {
+	fileArray, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadFile]", err)
+		}
+		return nil, nil, err
+	}
+
+	var (
+		element  = models.LayerElement{}
+		list     = make([]models.LayerElement, 0)
+		limits   = make(map[string][]models.LayerElement, 0)
+		problems ProblemList
+	)
+
+	for id, e := range fileArray {
+
+		// a frame folder is one element, other folders are limits
+		if e.IsDir() && !isFramesDir(e.Name()) {
+
+			limitList, _, err := g.getElementsFromDir(filepath.Join(dir, e.Name()), isColorSet, len(fileArray)+len(limits))
+
+			if err != nil {
+				problems.addError(err)
+			}
+
+			limits[e.Name()] = limitList
+
+			continue
+		}
+
+		element.Id = startId + id
+
+		name, rarity, color, err := g.cleanName(e.Name(), isColorSet)
+
+		if err != nil {
+			if g.debug {
+				g.log.Println("[ReadFileName]", err)
+				g.log.Println("[FileName]", dir+"/"+e.Name())
+			}
+			problems.add("%s: %s", dir+"/"+e.Name(), err)
+			continue
+		}
+
+		// ignore empty name
+		if name == "" {
+			continue
+		}
+		element.Name = name
+		element.Weight = rarity
+		element.Color = color
+		element.Path = dir + "/" + e.Name()
+
+		list = append(list, element)
+	}
+
+	return list, limits, problems.err()
+}
+
+// get name , rarity , color
+func (g *Generator) cleanName(name string, isColorSet bool) (string, float64, string, error) {
+
+	// filter system files, such as .DS_Store
+	if strings.HasPrefix(name, ".") {
+		return "", 0, "", nil
+	}
+
+	var color = ""
+
+	if isColorSet {
+		colorList := strings.Split(name, g.colorSetDelimiter)
+
+		if len(colorList) == 2 {
+			color = colorList[0]
+			name = colorList[1]
+		}
+	}
+
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	nameList := strings.Split(name, g.rarityDelimiter)
+
+	length := len(nameList)
+
+	if length > 2 {
+		return "", -1, "", errors.New("Too many rarity delimiter for: " + name)
+	}
+
+	var (
+		rarity float64 = 1
+		err    error
+	)
+
+	if length == 2 {
+		rarity, err = strconv.ParseFloat(nameList[1], 64)
+
+		if err != nil {
+			return "", -1, "", errors.New("Rarity parse error: " + err.Error())
+		}
+	}
+
+	return nameList[0], rarity, color, nil
+}
+
+// frame folders are named like files with the .frames extension, ie: blink#10.frames
+func isFramesDir(path string) bool {
+	return filepath.Ext(path) == framesDirExt
+}
+
+// images in a frame folder sorted by the numbers in their names, ie: 1.png, 2.png ... 10.png
+func (g *Generator) getFrameFiles(dir string) ([]string, error) {
+	fileArray, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadFile]", err)
+		}
+		return nil, err
+	}
+
+	var (
+		files   = make([]string, 0)
+		numbers = make(map[string]int, 0)
+	)
+
+	for _, f := range fileArray {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		number, err := strconv.Atoi(strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: frames should be named by numbers, such as 1.png", filepath.Join(dir, f.Name()))
+		}
+
+		files = append(files, filepath.Join(dir, f.Name()))
+		numbers[files[len(files)-1]] = number
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New(dir + ": no frame found")
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return numbers[files[i]] < numbers[files[j]]
+	})
+
+	return files, nil
+}
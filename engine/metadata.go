@@ -0,0 +1,285 @@
+// metadata
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+func (g *Generator) saveRarityFile(batch int, traits map[string]map[string]int) error {
+	return g.saveTraitsFile(fmt.Sprintf(BatchRarityFileName, batch+1), traits)
+}
+
+func (g *Generator) saveTraitsFile(name string, traits map[string]map[string]int) error {
+
+	var (
+		list      = make([]models.TraitLayer, 0)
+		layer     = models.TraitLayer{}
+		trait     = models.Trait{}
+		traitList []models.Trait
+	)
+
+	for la, elements := range traits {
+
+		layer.Name = la
+		layer.Total = len(elements)
+
+		var total = 0
+
+		for _, count := range elements {
+			total += count
+		}
+
+		traitList = make([]models.Trait, 0)
+
+		for name, count := range elements {
+			trait.Name = name
+			trait.Total = count
+			trait.Rate = fmt.Sprintf("%.1f%%", (float32(count)/float32(total))*100)
+
+			traitList = append(traitList, trait)
+		}
+
+		sort.Slice(traitList, func(i, j int) bool {
+			return traitList[i].Name < traitList[j].Name
+		})
+
+		layer.Elements = traitList
+
+		list = append(list, layer)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return g.saveJsonFile(filepath.Join(g.outputDir, name), &list)
+}
+
+func (g *Generator) saveJsonFile(path string, v interface{}) error {
+	err := utils.WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[SaveJson]", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (g *Generator) getMetadataPath(folder string, id int) string {
+	return filepath.Join(g.outputDir, folder, fmt.Sprintf("%d.json", id))
+}
+
+func (g *Generator) saveMetadataErc721(id int, dna *DNA, animated bool) error {
+	return g.writeMetadataFile(g.getMetadataPath(outputMetadataDir, id), getMetadataErc721(id, dna, g.config, animated), g.config.MetadataSettings.ExtraMetadata)
+}
+
+// animated editions also have an animation url, the image is the first frame
+func getMetadataErc721(id int, dna *DNA, config *models.Config, animated bool) *models.MetadataErc721 {
+	var metadata = models.MetadataErc721{}
+
+	if animated {
+		metadata.AnimationUrl = getAnimationUri(id, config)
+	}
+
+	if config.MetadataSettings.SaveDnaInMetadata {
+		metadata.Dna = utils.GetSha1Hash(dna.Key)
+	}
+
+	metadata.Attributes = getAttributes(config, dna)
+
+	applyConfigErc721(&metadata, id, config)
+
+	return &metadata
+}
+
+// fill the fields which only come from config, so metadata can be updated without rendering again
+func applyConfigErc721(metadata *models.MetadataErc721, id int, config *models.Config) {
+
+	metadata.Name = fmt.Sprintf("%s #%d", config.NamePrefix, id)
+
+	metadata.Description = config.Description
+
+	metadata.Image = fmt.Sprintf("%s/%d%s", config.BaseUri, id, getImageFormat(config.Format).ext)
+
+	// only animated editions have it
+	if metadata.AnimationUrl != "" {
+		metadata.AnimationUrl = getAnimationUri(id, config)
+	}
+
+	metadata.Variants = getVariantUris(id, config)
+
+	metadata.Compiler = "GoLips Art Engine"
+
+	metadata.ExtraMetadata = ""
+
+	if config.MetadataSettings.ExtraMetadata != nil {
+		metadata.ExtraMetadata = "has#@!"
+	}
+
+	metadata.Edition = 0
+
+	if config.MetadataSettings.ShowEditionInMetadata {
+		metadata.Edition = id
+	}
+}
+
+func (g *Generator) saveMetadataSolana(id int, dna *DNA, animated bool) error {
+	return g.writeMetadataFile(g.getMetadataPath(outputSolMetadataDir, id), getMetadataSolana(id, dna, g.config, animated), g.config.MetadataSettings.ExtraMetadata)
+}
+
+func getMetadataSolana(id int, dna *DNA, config *models.Config, animated bool) *models.MetadataSolana {
+	var metadata = models.MetadataSolana{}
+
+	if animated {
+		metadata.AnimationUrl = getAnimationFileName(id, config)
+	}
+
+	if config.MetadataSettings.SaveDnaInMetadata {
+		metadata.Dna = utils.GetSha1Hash(dna.Key)
+	}
+
+	metadata.Attributes = getAttributes(config, dna)
+
+	applyConfigSolana(&metadata, id, config)
+
+	return &metadata
+}
+
+func applyConfigSolana(metadata *models.MetadataSolana, id int, config *models.Config) {
+
+	metadata.Name = fmt.Sprintf("%s #%d", config.NamePrefix, id)
+	metadata.Symbol = config.SolanaMetadata.Symbol
+	metadata.SellerFeeBasisPoints = config.SolanaMetadata.SellerFeeBasisPoints
+
+	metadata.Description = config.Description
+
+	metadata.Image = fmt.Sprintf("%d%s", id, getImageFormat(config.Format).ext)
+
+	if metadata.AnimationUrl != "" {
+		metadata.AnimationUrl = getAnimationFileName(id, config)
+	}
+
+	metadata.Variants = getVariantUris(id, config)
+
+	metadata.ExternalUrl = config.SolanaMetadata.ExternalUrl
+
+	metadata.Compiler = "GoLips Art Engine"
+
+	metadata.ExtraMetadata = ""
+
+	if config.MetadataSettings.ExtraMetadata != nil {
+		metadata.ExtraMetadata = "has#@!"
+	}
+
+	metadata.Edition = 0
+
+	if config.MetadataSettings.ShowEditionInMetadata {
+		metadata.Edition = id
+	}
+
+	propFile := models.SolanaPropertyFile{
+		Uri:  metadata.Image,
+		Type: getImageFormat(config.Format).mimeType,
+	}
+
+	prop := models.SolanaProperty{
+		Category: "image",
+		Creators: config.SolanaMetadata.Creators,
+		Files:    []models.SolanaPropertyFile{propFile},
+	}
+
+	if metadata.AnimationUrl != "" {
+		prop.Files = append(prop.Files, models.SolanaPropertyFile{
+			Uri:  metadata.AnimationUrl,
+			Type: getAnimationFormat(config.Format.Animation).mimeType,
+		})
+	}
+
+	// in the order of the config
+	for _, v := range config.MultiVersionSettings.Variants {
+		if uri, ok := metadata.Variants[v.Name]; ok {
+			prop.Files = append(prop.Files, models.SolanaPropertyFile{
+				Uri:  uri,
+				Type: getImageFormat(config.Format).mimeType,
+			})
+		}
+	}
+
+	metadata.Properties = prop
+}
+
+// extra metadata is put into the place of the 'extra!@#' field
+func (g *Generator) writeMetadataFile(path string, metadata interface{}, extra *models.ExtraMetadata) error {
+
+	if extra == nil {
+		return g.saveJsonFile(path, metadata)
+	}
+
+	data, err := json.Marshal(metadata)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[JsonMarshal]", err)
+		}
+		return err
+	}
+
+	extraData, err := json.Marshal(extra)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[JsonMarshal]", err)
+		}
+		return err
+	}
+
+	extraStr := strings.Replace(string(extraData), "{", "", -1)
+
+	extraStr = strings.Replace(extraStr, "}", "", -1)
+
+	newString := strings.Replace(string(data), `"extra!@#":"has#@!"`, extraStr, -1)
+
+	err = utils.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, newString)
+		return err
+	})
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[WriteFile]", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// animations may be uploaded to another uri
+func getAnimationBaseUri(config *models.Config) string {
+	if config.Format.Animation.BaseUri != "" {
+		return config.Format.Animation.BaseUri
+	}
+
+	return config.BaseUri
+}
+
+func getAnimationFileName(id int, config *models.Config) string {
+	return fmt.Sprintf("%d%s", id, getAnimationFormat(config.Format.Animation).ext)
+}
+
+func getAnimationUri(id int, config *models.Config) string {
+	return fmt.Sprintf("%s/%s", getAnimationBaseUri(config), getAnimationFileName(id, config))
+}
@@ -0,0 +1,423 @@
+// oneofone
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golips_art_engine/models"
+)
+
+// dna of finished images, they never look like the dna of layers
+const oneOfOneKeyPrefix = "1/1:"
+
+// one of ones whose ids are not set are put at random ids, the ids of the other editions are kept for createDNA.
+// k-v: id - index in oneOfOnes of the layer configuration
+func (g *Generator) getOneOfOneIds(batch int, seed int64) (map[int]int, error) {
+
+	var (
+		c     = &g.config.LayerConfigurations[batch]
+		first = g.getFirstId(batch)
+		ids   = make(map[int]int, 0)
+	)
+
+	if len(c.OneOfOnes) == 0 {
+		return ids, nil
+	}
+
+	for i, o := range c.OneOfOnes {
+		if o.Id != 0 {
+			ids[o.Id] = i
+		}
+	}
+
+	var free = make([]int, 0)
+
+	for i := 0; i < c.GrowEditionSizeTo; i++ {
+		if _, exist := ids[first+i]; !exist {
+			free = append(free, first+i)
+		}
+	}
+
+	rng := newBatchRand(seed, batch, oneOfOneSource)
+
+	rng.Shuffle(len(free), func(i, j int) {
+		free[i], free[j] = free[j], free[i]
+	})
+
+	for i, o := range c.OneOfOnes {
+		if o.Id != 0 {
+			continue
+		}
+
+		// validateOneOfOnes finds it too, but it may be skipped with missing layers
+		if len(free) == 0 {
+			return nil, fmt.Errorf("no free id left for one of one %d of batch %d, the batch has %d editions", i, batch, c.GrowEditionSizeTo)
+		}
+
+		ids[free[0]] = i
+		free = free[1:]
+	}
+
+	return ids, nil
+}
+
+// the one of ones of every batch, their dna are added to the exist dnas before any edition is planned,
+// so generated editions never repeat them
+// 一比一作品的DNA会在规划其他NFT之前加入已有DNA中, 因此生成的NFT不会与它们重复
+func (g *Generator) planOneOfOnes(seed int64, existDNAs map[string]bool) (map[int]*Edition, error) {
+
+	var editions = make(map[int]*Edition, 0)
+
+	for batch, c := range g.config.LayerConfigurations {
+		ids, err := g.getOneOfOneIds(batch, seed)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range getSortedIdKeys(ids) {
+			ed, err := g.createOneOfOne(id, batch, seed, c.OneOfOnes[ids[id]])
+
+			if err != nil {
+				return nil, fmt.Errorf("one of one %d: %s", id, err)
+			}
+
+			if existDNAs[ed.DNA.Key] {
+				return nil, fmt.Errorf("one of one %d: the dna is used by another edition", id)
+			}
+
+			existDNAs[ed.DNA.Key] = true
+			editions[id] = ed
+		}
+	}
+
+	return editions, nil
+}
+
+// the dna of a one of one is fixed by config instead of createDNA.
+// a finished image is the only element of its dna, fixed elements get the background and number attributes like other editions
+func (g *Generator) createOneOfOne(id int, batch int, seed int64, o models.OneOfOne) (*Edition, error) {
+
+	var dna = &DNA{Batch: batch}
+
+	if o.Image != "" {
+		dna.Key = oneOfOneKeyPrefix + o.Image
+		dna.Elements = []models.LayerElement{{
+			Name:           o.Image,
+			Path:           filepath.Join(g.layersDir, o.Image),
+			HideInMetadata: true,
+			Opacity:        1,
+		}}
+		dna.finished = true
+		dna.attributes = append([]models.MetaDataAttribute{}, o.Attributes...)
+
+		return &Edition{Id: id, DNA: dna}, nil
+	}
+
+	var (
+		rng = newEditionRand(seed, id)
+		err error
+	)
+
+	dna.Key, dna.Elements, err = g.getOneOfOneElements(&g.config.LayerConfigurations[batch], o.Elements, rng)
+
+	if err != nil {
+		return nil, err
+	}
+
+	g.addPalette(dna, rng)
+	g.finishDNA(dna, rng)
+
+	return &Edition{Id: id, DNA: dna}, nil
+}
+
+// the elements of a one of one in the order of the layers, and the dna of them.
+// the color of 'layer^color$element' is the tint color of tinted layers, or the color of color set layers.
+// colors of color sets come from the color bases in the list, free tints without a color are picked by the random source
+func (g *Generator) getOneOfOneElements(c *models.LayerConfiguration, names []string, rng *rand.Rand) (string, []models.LayerElement, error) {
+
+	type pick struct {
+		name  string
+		color string
+	}
+
+	var (
+		picks     = make(map[string]pick, 0)
+		layers    = make(map[string]bool, 0)
+		colorSets = make(map[string]string, 0)
+
+		elementList = make([]models.LayerElement, 0)
+		dnaKeys     = make([]string, 0)
+	)
+
+	for _, layer := range c.LayersOrder {
+		layers[layer.Options.DisplayName] = true
+	}
+
+	for _, s := range names {
+		parts := strings.SplitN(s, g.limitDelimiter, 2)
+
+		if len(parts) != 2 {
+			return "", nil, fmt.Errorf("'%s' should be named like 'layer%selement'", s, g.limitDelimiter)
+		}
+
+		if !layers[parts[0]] {
+			return "", nil, fmt.Errorf("no layer named '%s'", parts[0])
+		}
+
+		if _, exist := picks[parts[0]]; exist {
+			return "", nil, fmt.Errorf("'%s' has another element in layer '%s'", s, parts[0])
+		}
+
+		p := pick{name: parts[1]}
+
+		if i := strings.Index(p.name, g.colorSetDelimiter); i >= 0 {
+			p.color, p.name = p.name[:i], p.name[i+len(g.colorSetDelimiter):]
+		}
+
+		picks[parts[0]] = p
+	}
+
+	for _, layer := range c.LayersOrder {
+		p, exist := picks[layer.Options.DisplayName]
+
+		if !exist || layer.Options.ColorSet == "" || !layer.Options.IsColorBase {
+			continue
+		}
+
+		if layer.Options.Tint != nil {
+			colorSets[layer.Options.ColorSet] = p.color
+		} else {
+			colorSets[layer.Options.ColorSet] = p.name
+		}
+	}
+
+	for _, layer := range c.LayersOrder {
+		p, exist := picks[layer.Options.DisplayName]
+
+		if !exist {
+			continue
+		}
+
+		// the color of the file, only color set layers without tint have it
+		var color = ""
+
+		if layer.Options.ColorSet != "" && !layer.Options.IsColorBase && layer.Options.Tint == nil {
+			color = p.color
+
+			if color == "" {
+				color = colorSets[layer.Options.ColorSet]
+			}
+		}
+
+		var list = append([]models.LayerElement{}, layer.Elements...)
+
+		for _, k := range getSortedLimitKeys(layer.Limits) {
+			list = append(list, layer.Limits[k]...)
+		}
+
+		var found = false
+
+		for _, v := range list {
+			if v.Name != p.name || (color != "" && v.Color != color) {
+				continue
+			}
+
+			v.BelongLayerName = layer.Options.DisplayName
+			v.HideInMetadata = layer.Options.HideInMetadata
+			v.BlendMode = layer.Options.BlendMode
+			v.Opacity = getLayerOpacity(layer.Options)
+			v.Placement = getElementPlacement(layer, v.Name)
+
+			tint, err := g.getOneOfOneTint(layer, p.color, colorSets, rng)
+
+			if err != nil {
+				return "", nil, err
+			}
+
+			v.Tint = tint
+
+			elementList = append(elementList, v)
+
+			if !layer.Options.BypassDNA {
+				dnaKey := g.getLimitKey(layer.Options.DisplayName, v.Name)
+
+				// tinted elements are named like the files of color sets, ie: red$fat
+				if v.Tint != nil {
+					dnaKey = g.getLimitKey(layer.Options.DisplayName, v.Tint.Color.Name+g.colorSetDelimiter+v.Name)
+				}
+
+				dnaKeys = append(dnaKeys, dnaKey)
+			}
+
+			found = true
+			break
+		}
+
+		if !found && color != "" {
+			return "", nil, fmt.Errorf("no element named '%s' of color '%s' in layer '%s'", p.name, color, layer.Options.DisplayName)
+		}
+
+		if !found {
+			return "", nil, fmt.Errorf("no element named '%s' in layer '%s'", p.name, layer.Options.DisplayName)
+		}
+	}
+
+	return strings.Join(dnaKeys, g.dnaDelimiter), elementList, nil
+}
+
+// the tint of a fixed element, the color in its name goes first, then the color of its color set
+func (g *Generator) getOneOfOneTint(layer models.LayerOrder, color string, colorSets map[string]string, rng *rand.Rand) (*models.ElementTint, error) {
+
+	var tint = layer.Options.Tint
+
+	if tint == nil {
+		return nil, nil
+	}
+
+	if color == "" && layer.Options.ColorSet != "" {
+		color = colorSets[layer.Options.ColorSet]
+	}
+
+	if color == "" && layer.Options.ColorSet != "" {
+		return nil, fmt.Errorf("layer '%s' needs a color like 'layer%scolor%selement', its color set has no base in the list", layer.Options.DisplayName, g.limitDelimiter, g.colorSetDelimiter)
+	}
+
+	// a free tint picks the color itself
+	if color == "" {
+		return getElementTint(layer, colorSets, rng), nil
+	}
+
+	for _, c := range tint.Colors {
+		if c.Name == color {
+			return &models.ElementTint{
+				Mode:      tint.Mode,
+				TraitName: tint.TraitName,
+				Color:     c,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no tint color named '%s' in layer '%s'", color, layer.Options.DisplayName)
+}
+
+// how many one of ones have every element, finished images have none.
+// k-v: 'layer^element' - count
+func (g *Generator) countOneOfOneElements(c *models.LayerConfiguration) map[string]int {
+
+	var counts = make(map[string]int, 0)
+
+	for _, o := range c.OneOfOnes {
+		if o.Image != "" {
+			continue
+		}
+
+		// wrong elements are found by validateOneOfOnes, free tints don't change the names
+		_, elements, err := g.getOneOfOneElements(c, o.Elements, rand.New(rand.NewSource(0)))
+
+		if err != nil {
+			continue
+		}
+
+		for _, v := range elements {
+			counts[g.getLimitKey(v.BelongLayerName, v.Name)] += 1
+		}
+	}
+
+	return counts
+}
+
+// ids, images and elements of the one of ones, problems of their dna are found by Plan
+func (g *Generator) validateOneOfOnes(c *models.LayerConfiguration, batch int, prefix string) ProblemList {
+
+	var problems ProblemList
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	if len(c.OneOfOnes) > c.GrowEditionSizeTo {
+		field(prefix+".oneOfOnes", "%d one of ones are more than the %d editions of growEditionSizeTo", len(c.OneOfOnes), c.GrowEditionSizeTo)
+	}
+
+	var (
+		first = g.getFirstId(batch)
+		ids   = make(map[int]bool, 0)
+	)
+
+	for i, o := range c.OneOfOnes {
+		name := fmt.Sprintf("%s.oneOfOnes[%d]", prefix, i)
+
+		switch {
+		case o.Id == 0:
+		case o.Id < first || o.Id >= first+c.GrowEditionSizeTo:
+			field(name+".id", "%d is not one of the ids %d ~ %d of the batch", o.Id, first, first+c.GrowEditionSizeTo-1)
+		case ids[o.Id]:
+			field(name+".id", "%d is used by another one of one", o.Id)
+		}
+
+		ids[o.Id] = true
+
+		if (o.Image == "") == (len(o.Elements) == 0) {
+			field(name, "should set either image or elements")
+			continue
+		}
+
+		if o.Image == "" {
+			if len(o.Attributes) > 0 {
+				field(name+".attributes", "only finished images have attributes, elements are the attributes")
+			}
+
+			// free tints are picked later, any color passes here
+			_, _, err := g.getOneOfOneElements(c, o.Elements, rand.New(rand.NewSource(0)))
+
+			if err != nil {
+				field(name+".elements", "%s", err)
+			}
+
+			continue
+		}
+
+		path := filepath.Join(g.layersDir, o.Image)
+
+		if _, err := os.Stat(path); err != nil {
+			field(name+".image", "no file named '%s' under %s", o.Image, g.layersDir)
+			continue
+		}
+
+		// svg documents put the finished image into the edition as it is
+		if g.config.Format.Type == formatSvg {
+			if !isSvgFile(path) {
+				field(name+".image", "'%s' should be an svg file, format.type is svg", o.Image)
+			} else if _, err := g.readSvgFragment(path); err != nil {
+				field(name+".image", "%s", err)
+			}
+
+			continue
+		}
+
+		if _, err := g.decodeImageFile(path); err != nil {
+			field(name+".image", "%s", err)
+		}
+	}
+
+	return problems
+}
+
+func getSortedIdKeys(m map[int]int) []int {
+
+	var keys = make([]int, 0, len(m))
+
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Ints(keys)
+
+	return keys
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestGetOneOfOneIds(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 5,
+		"layersOrder": `+testLayersOrder+`,
+		"oneOfOnes": [{"image": "a.png"}, {"id": 3, "image": "b.png"}, {"image": "c.png"}]
+	}]`, `{}`)
+
+	// ids don't need the layers, so Validate is not called
+	g := New(config, Options{})
+
+	for seed := int64(1); seed <= 10; seed++ {
+		ids, err := g.getOneOfOneIds(0, seed)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ids) != 3 || ids[3] != 1 {
+			t.Fatalf("seed %d: ids %v, want 3 ids with 3 for the second one", seed, ids)
+		}
+
+		for id, _ := range ids {
+			if id < 1 || id > 5 {
+				t.Errorf("seed %d: id %d is not in the batch", seed, id)
+			}
+		}
+	}
+
+	// more one of ones than ids, without validation
+	config.LayerConfigurations[0].GrowEditionSizeTo = 1
+
+	if _, err := g.getOneOfOneIds(0, 1); err == nil {
+		t.Error("no error for one of ones without a free id")
+	}
+}
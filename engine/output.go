@@ -0,0 +1,278 @@
+// output
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// UpdateRarity counts the traits from the metadata files and saves the rarity file, generate saves it the same way,
+// so it still works after editing metadata by hand. returns how many editions are counted
+func (g *Generator) UpdateRarity() (int, error) {
+
+	// solana metadata is read when there is no erc721 metadata, both have the same attributes
+	var folder = outputMetadataDir
+
+	if !g.config.MetadataSettings.OutputEthFormat && g.config.MetadataSettings.OutputSOLFormat {
+		folder = outputSolMetadataDir
+	}
+
+	ids, err := g.getGeneratedIds(folder, ".json")
+
+	if err != nil {
+		return 0, err
+	}
+
+	traits := make(map[string]map[string]int, 0)
+
+	for _, id := range ids {
+		var metadata struct {
+			Attributes []models.MetaDataAttribute `json:"attributes"`
+		}
+
+		body, err := ioutil.ReadFile(g.getMetadataPath(folder, id))
+
+		if err != nil {
+			return 0, err
+		}
+
+		err = json.Unmarshal(body, &metadata)
+
+		if err != nil {
+			return 0, fmt.Errorf("%d.json: %s", id, err)
+		}
+
+		for _, attr := range metadata.Attributes {
+
+			// number attributes are not traits
+			if attr.DisplayType != "" {
+				continue
+			}
+
+			if traits[attr.TraitType] == nil {
+				traits[attr.TraitType] = make(map[string]int, 0)
+			}
+
+			traits[attr.TraitType][fmt.Sprint(attr.Value)] += 1
+		}
+	}
+
+	err = g.saveTraitsFile(RarityFileName, traits)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// UpdateMetadata rewrites the fields from config, attributes and dna are kept.
+// returns how many files are updated
+func (g *Generator) UpdateMetadata() (int, error) {
+
+	var config = g.config
+
+	// image urls use the extension of format.type
+	err := g.validateFormat(&config.Format).err()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var updated = 0
+
+	if config.MetadataSettings.OutputEthFormat {
+		ids, err := g.getGeneratedIds(outputMetadataDir, ".json")
+
+		if err != nil {
+			return updated, err
+		}
+
+		for _, id := range ids {
+			var (
+				metadata models.MetadataErc721
+				path     = g.getMetadataPath(outputMetadataDir, id)
+			)
+
+			body, err := ioutil.ReadFile(path)
+
+			if err != nil {
+				return updated, err
+			}
+
+			err = json.Unmarshal(body, &metadata)
+
+			if err != nil {
+				return updated, fmt.Errorf("%s: %s", path, err)
+			}
+
+			applyConfigErc721(&metadata, id, config)
+
+			err = g.writeMetadataFile(path, &metadata, config.MetadataSettings.ExtraMetadata)
+
+			if err != nil {
+				return updated, err
+			}
+
+			updated += 1
+		}
+	}
+
+	if config.MetadataSettings.OutputSOLFormat {
+		ids, err := g.getGeneratedIds(outputSolMetadataDir, ".json")
+
+		if err != nil {
+			return updated, err
+		}
+
+		for _, id := range ids {
+			var (
+				metadata models.MetadataSolana
+				path     = g.getMetadataPath(outputSolMetadataDir, id)
+			)
+
+			body, err := ioutil.ReadFile(path)
+
+			if err != nil {
+				return updated, err
+			}
+
+			err = json.Unmarshal(body, &metadata)
+
+			if err != nil {
+				return updated, fmt.Errorf("%s: %s", path, err)
+			}
+
+			applyConfigSolana(&metadata, id, config)
+
+			err = g.writeMetadataFile(path, &metadata, config.MetadataSettings.ExtraMetadata)
+
+			if err != nil {
+				return updated, err
+			}
+
+			updated += 1
+		}
+	}
+
+	return updated, nil
+}
+
+// SavePreview puts the generated images together into one image, count 0 means all.
+// returns how many images are in the preview
+func (g *Generator) SavePreview(count int, columns int, size int) (int, error) {
+
+	if columns < 1 || size < 1 {
+		return 0, errors.New("columns and size should be greater than 0")
+	}
+
+	var config = g.config
+
+	err := g.validateFormat(&config.Format).err()
+
+	if err != nil {
+		return 0, err
+	}
+
+	// there is no webp decoder in the standard library
+	if config.Format.Type == formatWebp {
+		return 0, errors.New("webp images can not be read, preview needs png or jpeg images")
+	}
+
+	ext := getImageFormat(config.Format).ext
+
+	ids, err := g.getGeneratedIds(outputImagesDir, ext)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, errors.New("no image found in " + filepath.Join(g.outputDir, outputImagesDir))
+	}
+
+	if count > 0 && count < len(ids) {
+		ids = ids[:count]
+	}
+
+	var (
+		preview *image.RGBA
+		height  int
+		rows    = (len(ids) + columns - 1) / columns
+	)
+
+	for i, id := range ids {
+		// svg documents are drawn, animated images show the first frame
+		frames, err := g.decodeImageFile(g.getImagePath(outputImagesDir, id, config.Format))
+
+		if err != nil {
+			return 0, err
+		}
+
+		img := frames[0]
+
+		if preview == nil {
+			height = size * img.Bounds().Dy() / img.Bounds().Dx()
+
+			preview = image.NewRGBA(image.Rect(0, 0, size*columns, height*rows))
+		}
+
+		thumb := utils.ResizeNearest(img, size, height)
+
+		at := image.Pt(i%columns*size, i/columns*height)
+
+		draw.Draw(preview, thumb.Bounds().Add(at), thumb, image.ZP, draw.Src)
+	}
+
+	// the preview is always a png
+	err = g.saveImage(filepath.Join(g.outputDir, PreviewFileName), preview, models.OutputFormat{Type: formatPng})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// ids of the generated files in the folder, in order
+func (g *Generator) getGeneratedIds(folder string, ext string) ([]int, error) {
+	fileArray, err := ioutil.ReadDir(filepath.Join(g.outputDir, folder))
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadFile]", err)
+		}
+		return nil, err
+	}
+
+	ids := make([]int, 0)
+
+	for _, f := range fileArray {
+		if f.IsDir() || filepath.Ext(f.Name()) != ext {
+			continue
+		}
+
+		id, err := strconv.Atoi(strings.TrimSuffix(f.Name(), ext))
+
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids, nil
+}
@@ -0,0 +1,101 @@
+// placement
+package engine
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golips_art_engine/models"
+)
+
+// k-v: anchor - position of the image in the free space of the canvas, 0 is left or top and 1 is right or bottom
+var anchors = map[string][2]float64{
+	"top-left":      {0, 0},
+	"top":           {0.5, 0},
+	"top-center":    {0.5, 0},
+	"top-right":     {1, 0},
+	"left":          {0, 0.5},
+	"center-left":   {0, 0.5},
+	"center":        {0.5, 0.5},
+	"right":         {1, 0.5},
+	"center-right":  {1, 0.5},
+	"bottom-left":   {0, 1},
+	"bottom":        {0.5, 1},
+	"bottom-center": {0.5, 1},
+	"bottom-right":  {1, 1},
+}
+
+// the placement of the layer, with the fields of the element placement on top of it.
+// nil if nothing is set, then the image is scaled to the canvas
+func getElementPlacement(layer models.LayerOrder, name string) *models.Placement {
+
+	var (
+		p       = layer.Options.Placement
+		element = layer.Options.Elements[name]
+	)
+
+	if element.X != nil {
+		p.X = element.X
+	}
+
+	if element.Y != nil {
+		p.Y = element.Y
+	}
+
+	if element.Anchor != "" {
+		p.Anchor = element.Anchor
+	}
+
+	if element.Scale != nil {
+		p.Scale = element.Scale
+	}
+
+	if p.X == nil && p.Y == nil && p.Anchor == "" && p.Scale == nil {
+		return nil
+	}
+
+	return &p
+}
+
+func getPlacementScale(p *models.Placement) float64 {
+	if p == nil || p.Scale == nil {
+		return 1
+	}
+
+	return *p.Scale
+}
+
+// the rectangle of the canvas the image is drawn in
+func getPlacementRect(p *models.Placement, size image.Point, canvas image.Point) image.Rectangle {
+
+	// no anchor is the same as top-left
+	var (
+		anchor = anchors[p.Anchor]
+		x      = int(math.Round(anchor[0] * float64(canvas.X-size.X)))
+		y      = int(math.Round(anchor[1] * float64(canvas.Y-size.Y)))
+	)
+
+	if p.X != nil {
+		x += *p.X
+	}
+
+	if p.Y != nil {
+		y += *p.Y
+	}
+
+	return image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)}
+}
+
+func validatePlacement(p models.Placement) error {
+
+	if _, exist := anchors[p.Anchor]; p.Anchor != "" && !exist {
+		return fmt.Errorf("unknown anchor '%s'", p.Anchor)
+	}
+
+	if p.Scale != nil && *p.Scale <= 0 {
+		return fmt.Errorf("scale should be greater than 0")
+	}
+
+	return nil
+}
@@ -0,0 +1,406 @@
+// quotas
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golips_art_engine/models"
+)
+
+// an element with a quota, count is the exact count or the max count left for the generated editions
+type quotaElement struct {
+	key   string
+	layer string
+	count int
+	// index in the quotas of config
+	index int
+}
+
+// quotas of a layer configuration, nil if it has no quota
+type quotaSet struct {
+	rules *ruleSet
+	exact []quotaElement
+	max   []quotaElement
+}
+
+// the quotas planned for every edition of a batch, before any dna is created.
+// every edition knows which elements it must have and which it can not have, so the counts are exact
+// 在生成DNA之前为每个NFT规划好配额, 每个NFT都知道必须包含和不能包含的元素, 因此数量是精确的
+type quotaPlan struct {
+	seed int64
+	// signature of every edition, in the order of the batch
+	slots []string
+	// k-v: signature - counter with the forced and banned elements
+	counters map[string]*combinationCounter
+}
+
+// nil if the layer configuration has no quota
+func (g *Generator) compileQuotas(c *models.LayerConfiguration, rules *ruleSet, prefix string) (*quotaSet, ProblemList) {
+
+	var problems ProblemList
+
+	if len(c.Quotas) == 0 {
+		return nil, problems
+	}
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	var (
+		q      = &quotaSet{rules: rules}
+		layers = rules
+		seen   = make(map[string]bool, 0)
+		// k-v: layer - editions planned by exact counts
+		planned = make(map[string]int, 0)
+		// one of ones are not planned, their elements are taken off the counts
+		// 一比一作品不参与规划, 其中的元素会从配额数量中扣除
+		used = g.countOneOfOneElements(c)
+		// editions the quotas are planned in
+		free     = c.GrowEditionSizeTo - len(c.OneOfOnes)
+		editions = fmt.Sprintf("the %d editions of growEditionSizeTo", c.GrowEditionSizeTo)
+		besides  = ""
+	)
+
+	if len(c.OneOfOnes) > 0 {
+		editions = fmt.Sprintf("the %d editions of growEditionSizeTo without the %d one of ones", free, len(c.OneOfOnes))
+		besides = " besides the one of ones"
+	}
+
+	if layers == nil {
+		layers = g.newRuleSet(c)
+	}
+
+	for i, quota := range c.Quotas {
+		name := fmt.Sprintf("%s.quotas[%d]", prefix, i)
+
+		element, err := layers.parseElement(quota.Element)
+
+		if err != nil {
+			field(name+".element", "%s", err)
+			continue
+		}
+
+		if seen[element.key] {
+			field(name+".element", "'%s' has another quota", element.key)
+			continue
+		}
+
+		seen[element.key] = true
+
+		switch {
+		case quota.Count < 0 || quota.Max < 0:
+			field(name, "count and max should not be negative")
+		case (quota.Count > 0) == (quota.Max > 0):
+			field(name, "should set either count or max")
+		case quota.Count-used[element.key] > free:
+			field(name+".count", "%d%s is more than %s", quota.Count-used[element.key], besides, editions)
+		case quota.Count > 0 && used[element.key] > quota.Count:
+			field(name+".count", "'%s' is in %d one of ones, more than the count %d", element.key, used[element.key], quota.Count)
+		case quota.Max > 0 && used[element.key] > quota.Max:
+			field(name+".max", "'%s' is in %d one of ones, more than the max %d", element.key, used[element.key], quota.Max)
+		case quota.Count > 0:
+			q.exact = append(q.exact, quotaElement{key: element.key, layer: element.layer, count: quota.Count - used[element.key], index: i})
+			planned[element.layer] += quota.Count - used[element.key]
+		default:
+			q.max = append(q.max, quotaElement{key: element.key, layer: element.layer, count: quota.Max - used[element.key], index: i})
+		}
+	}
+
+	for _, layer := range getSortedCountKeys(planned) {
+		if planned[layer] > free {
+			field(prefix+".quotas", "the counts of layer '%s'%s add up to %d, more than %s", layer, besides, planned[layer], editions)
+		}
+	}
+
+	return q, problems
+}
+
+// elements with more exact count than the dna they can be in
+func (g *Generator) validateQuotas(c *models.LayerConfiguration, quotas *quotaSet, prefix string) ProblemList {
+
+	var problems ProblemList
+
+	for _, e := range quotas.exact {
+		counter := g.newCombinationCounter(c, quotas.rules)
+		counter.forced = map[string]bool{e.key: true}
+
+		count := counter.count()
+
+		if float64(e.count) > count.Max {
+			problems.add("%s: %s.quotas[%d].count: '%s' is in %s possible combinations, less than the count %d", g.configPath, prefix, e.index, e.key, FormatCombinations(count), e.count)
+		}
+	}
+
+	return problems
+}
+
+// the quotas of the batch are planned once for every seed, Plan and Replay get the same plan
+func (g *Generator) getQuotaPlan(batch int, seed int64) (*quotaPlan, error) {
+
+	g.quotaMutex.Lock()
+	defer g.quotaMutex.Unlock()
+
+	if g.quotas[batch] == nil {
+		return nil, nil
+	}
+
+	if plan := g.quotaPlans[batch]; plan != nil && plan.seed == seed {
+		return plan, nil
+	}
+
+	plan, err := g.planQuotas(batch, seed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	g.quotaPlans[batch] = plan
+
+	return plan, nil
+}
+
+// elements with max counts can only be picked in that many random editions,
+// exact counts are put into random editions which can still create enough distinct dna with them
+func (g *Generator) planQuotas(batch int, seed int64) (*quotaPlan, error) {
+
+	var (
+		c      = &g.config.LayerConfigurations[batch]
+		quotas = g.quotas[batch]
+		size   = c.GrowEditionSizeTo
+		rng    = newBatchRand(seed, batch, quotaSource)
+
+		plan = &quotaPlan{
+			seed:     seed,
+			slots:    make([]string, size),
+			counters: make(map[string]*combinationCounter, 0),
+		}
+
+		forced  = make([]map[string]bool, size)
+		allowed = make([]map[string]bool, size)
+		// k-v: key - quota element
+		all = make(map[string]quotaElement, 0)
+	)
+
+	for i := 0; i < size; i++ {
+		forced[i] = make(map[string]bool, 0)
+		allowed[i] = make(map[string]bool, 0)
+	}
+
+	for _, e := range quotas.exact {
+		all[e.key] = e
+	}
+
+	for _, e := range quotas.max {
+		all[e.key] = e
+	}
+
+	// one of ones are not planned by createDNA, their elements are taken off the counts by compileQuotas
+	oneOfOnes, err := g.getOneOfOneIds(batch, seed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		first = g.getFirstId(batch)
+		free  = make([]int, 0)
+	)
+
+	for i := 0; i < size; i++ {
+		if _, exist := oneOfOnes[first+i]; !exist {
+			free = append(free, i)
+		}
+	}
+
+	shuffled := func() []int {
+		var list = make([]int, 0, len(free))
+
+		for _, j := range rng.Perm(len(free)) {
+			list = append(list, free[j])
+		}
+
+		return list
+	}
+
+	// max counts only make the editions looser, so they are planned first
+	for _, e := range quotas.max {
+		var count = e.count
+
+		if count > len(free) {
+			count = len(free)
+		}
+
+		for _, i := range shuffled()[:count] {
+			allowed[i][e.key] = true
+		}
+	}
+
+	// elements of other quotas are banned, unless they are planned into the edition
+	counterOf := func(i int, next map[string]bool) *combinationCounter {
+		var banned = make(map[string]bool, 0)
+
+		for k, _ := range all {
+			if !next[k] && !allowed[i][k] {
+				banned[k] = true
+			}
+		}
+
+		return g.getQuotaCounter(plan, c, quotas, next, banned)
+	}
+
+	var (
+		// k-v: signature - editions
+		editions = make(map[string]int, 0)
+		// k-v: signature - how many editions can be different
+		capacity = make(map[string]float64, 0)
+	)
+
+	for _, i := range free {
+		plan.slots[i] = getQuotaSignature(counterOf(i, forced[i]))
+		editions[plan.slots[i]] += 1
+	}
+
+	getCapacity := func(signature string) float64 {
+		if _, exist := capacity[signature]; !exist {
+			capacity[signature] = plan.counters[signature].count().Max
+		}
+
+		return capacity[signature]
+	}
+
+	// the largest counts have the most editions to choose from
+	exact := append([]quotaElement{}, quotas.exact...)
+
+	sort.SliceStable(exact, func(i, j int) bool {
+		return exact[i].count > exact[j].count
+	})
+
+	for _, e := range exact {
+		var (
+			placed     = 0
+			candidates = shuffled()
+		)
+
+		// editions are taken from the most crowded quotas first, so every quota has enough distinct dna
+		sort.SliceStable(candidates, func(a, b int) bool {
+			sa, sb := plan.slots[candidates[a]], plan.slots[candidates[b]]
+
+			return float64(editions[sa])/getCapacity(sa) > float64(editions[sb])/getCapacity(sb)
+		})
+
+		for _, i := range candidates {
+			if placed == e.count {
+				break
+			}
+
+			if hasQuotaLayer(forced[i], all, e.layer) {
+				continue
+			}
+
+			next := copyBoolMap(forced[i])
+			next[e.key] = true
+
+			signature := getQuotaSignature(counterOf(i, next))
+
+			if float64(editions[signature]) >= getCapacity(signature) {
+				continue
+			}
+
+			editions[plan.slots[i]] -= 1
+			editions[signature] += 1
+
+			forced[i] = next
+			plan.slots[i] = signature
+			placed++
+		}
+
+		if placed < e.count {
+			return nil, fmt.Errorf("only %d of %d editions can have '%s', please check the quotas and the rules", placed, e.count, e.key)
+		}
+	}
+
+	for _, signature := range getSortedCountKeys(editions) {
+		if editions[signature] > 0 && float64(editions[signature]) > getCapacity(signature) {
+			return nil, fmt.Errorf("%d editions are planned with the same quotas, but they can only create %s dna", editions[signature], FormatCombinations(plan.counters[signature].count()))
+		}
+	}
+
+	return plan, nil
+}
+
+// editions with the same forced and banned elements share a counter
+func (g *Generator) getQuotaCounter(plan *quotaPlan, c *models.LayerConfiguration, quotas *quotaSet, forced map[string]bool, banned map[string]bool) *combinationCounter {
+
+	signature := getQuotaKey(forced, banned)
+
+	if counter, exist := plan.counters[signature]; exist {
+		return counter
+	}
+
+	counter := g.newCombinationCounter(c, quotas.rules)
+	counter.forced = forced
+	counter.banned = banned
+
+	plan.counters[signature] = counter
+
+	return counter
+}
+
+// the counter of the edition at the index of the batch, the counter of the rules without quotas
+func (g *Generator) getEditionCounter(batch int, index int, plan *quotaPlan) *combinationCounter {
+
+	if plan == nil {
+		return g.counters[batch]
+	}
+
+	return plan.counters[plan.slots[index]]
+}
+
+func getQuotaSignature(counter *combinationCounter) string {
+	return getQuotaKey(counter.forced, counter.banned)
+}
+
+func getQuotaKey(forced map[string]bool, banned map[string]bool) string {
+
+	var keys = make([]string, 0)
+
+	for k, _ := range forced {
+		keys = append(keys, "f:"+k)
+	}
+
+	for k, _ := range banned {
+		keys = append(keys, "b:"+k)
+	}
+
+	sort.Strings(keys)
+
+	return strings.Join(keys, "\n")
+}
+
+// an element of the layer is already forced
+func hasQuotaLayer(forced map[string]bool, all map[string]quotaElement, layer string) bool {
+
+	for k, _ := range forced {
+		if all[k].layer == layer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getSortedCountKeys(m map[string]int) []string {
+
+	var keys = make([]string, 0, len(m))
+
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlanQuotas(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 25,
+		"layersOrder": `+testLayersOrder+`,
+		"quotas": [
+			{"element": "Hat^crown", "count": 7},
+			{"element": "Eyes^laser", "count": 10},
+			{"element": "Body^gold", "max": 3}
+		]
+	}]`, `{}`)
+
+	g := mustTestGenerator(t, config)
+
+	for seed := int64(1); seed <= 10; seed++ {
+		editions, err := g.Plan(seed, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+
+		counts := countTestElements(editions)
+
+		if counts["Hat^crown"] != 7 || counts["Eyes^laser"] != 10 {
+			t.Errorf("seed %d: %d crowns and %d lasers, want 7 and 10", seed, counts["Hat^crown"], counts["Eyes^laser"])
+		}
+
+		if counts["Body^gold"] > 3 {
+			t.Errorf("seed %d: %d gold bodies, want at most 3", seed, counts["Body^gold"])
+		}
+
+		assertReplay(t, g, seed, editions)
+	}
+}
+
+func TestPlanQuotasWithRules(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 30,
+		"layersOrder": `+testLayersOrder+`,
+		"rules": [
+			{"type": "excludes", "element": "Hat^crown", "target": "Eyes^laser"},
+			{"type": "requires", "element": "Hat^halo", "target": "Body^gold"}
+		],
+		"quotas": [
+			{"element": "Hat^crown", "count": 10},
+			{"element": "Eyes^laser", "count": 8},
+			{"element": "Hat^halo", "count": 4}
+		]
+	}]`, `{}`)
+
+	g := mustTestGenerator(t, config)
+
+	for seed := int64(1); seed <= 10; seed++ {
+		editions, err := g.Plan(seed, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+
+		counts := countTestElements(editions)
+
+		if counts["Hat^crown"] != 10 || counts["Eyes^laser"] != 8 || counts["Hat^halo"] != 4 {
+			t.Errorf("seed %d: counts %v", seed, counts)
+		}
+
+		for _, ed := range editions {
+			if hasTestElement(ed, "Hat^crown") && hasTestElement(ed, "Eyes^laser") {
+				t.Errorf("seed %d: edition %d has a crown and a laser", seed, ed.Id)
+			}
+
+			if hasTestElement(ed, "Hat^halo") && !hasTestElement(ed, "Body^gold") {
+				t.Errorf("seed %d: edition %d has a halo without gold", seed, ed.Id)
+			}
+		}
+
+		assertReplay(t, g, seed, editions)
+	}
+}
+
+func TestQuotasWithOneOfOnes(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 20,
+		"layersOrder": `+testLayersOrder+`,
+		"quotas": [
+			{"element": "Hat^crown", "count": 3},
+			{"element": "Eyes^laser", "max": 1}
+		],
+		"oneOfOnes": [
+			{"elements": ["Body^gold", "Hat^crown", "Eyes^laser"]},
+			{"id": 5, "elements": ["Body^wood", "Hat^crown", "Eyes^wink"]}
+		]
+	}]`, `{}`)
+
+	g := mustTestGenerator(t, config)
+
+	for seed := int64(1); seed <= 10; seed++ {
+		editions, err := g.Plan(seed, make(map[string]bool, 0))
+
+		if err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+
+		counts := countTestElements(editions)
+
+		// the one of ones count towards the quotas
+		if counts["Hat^crown"] != 3 || counts["Eyes^laser"] != 1 {
+			t.Errorf("seed %d: %d crowns and %d lasers, want 3 and 1", seed, counts["Hat^crown"], counts["Eyes^laser"])
+		}
+
+		assertReplay(t, g, seed, editions)
+	}
+}
+
+func TestQuotaProblems(t *testing.T) {
+
+	var cases = []struct {
+		name    string
+		quotas  string
+		extra   string
+		problem string
+	}{
+		{
+			name:    "more than the combinations",
+			quotas:  `[{"element": "Hat^crown", "count": 17}]`,
+			problem: "'Hat^crown' is in 16 possible combinations, less than the count 17",
+		},
+		{
+			name:    "more than the editions",
+			quotas:  `[{"element": "Hat^crown", "count": 21}]`,
+			problem: "21 is more than the 20 editions of growEditionSizeTo",
+		},
+		{
+			name:    "a layer adds up to more than the editions",
+			quotas:  `[{"element": "Hat^crown", "count": 12}, {"element": "Hat^cap", "count": 12}]`,
+			problem: "the counts of layer 'Hat' add up to 24",
+		},
+		{
+			name:    "excluded by a rule",
+			quotas:  `[{"element": "Hat^crown", "count": 5}]`,
+			extra:   `"rules": [{"type": "requires", "element": "Hat^crown", "target": "Body^gold"}, {"type": "excludes", "element": "Hat^crown", "target": "Eyes^laser"}],`,
+			problem: "'Hat^crown' is in 3 possible combinations, less than the count 5",
+		},
+		{
+			name:    "count and max",
+			quotas:  `[{"element": "Hat^crown", "count": 2, "max": 3}]`,
+			problem: "should set either count or max",
+		},
+		{
+			name:    "unknown element",
+			quotas:  `[{"element": "Hat^tiara", "count": 2}]`,
+			problem: "no element named 'tiara' in layer 'Hat'",
+		},
+		{
+			name:    "less than the one of ones",
+			quotas:  `[{"element": "Hat^crown", "count": 1}]`,
+			extra:   `"oneOfOnes": [{"elements": ["Hat^crown"]}, {"elements": ["Body^gold", "Hat^crown"]}],`,
+			problem: "'Hat^crown' is in 2 one of ones, more than the count 1",
+		},
+		{
+			name:    "more than the editions left by the one of ones",
+			quotas:  `[{"element": "Hat^crown", "count": 12}, {"element": "Hat^cap", "count": 6}]`,
+			extra:   `"oneOfOnes": [{"elements": ["Eyes^laser"]}, {"elements": ["Eyes^plain"]}, {"elements": ["Eyes^wink"]}],`,
+			problem: "the counts of layer 'Hat' besides the one of ones add up to 18, more than the 17 editions of growEditionSizeTo without the 3 one of ones",
+		},
+		{
+			name:    "one count more than the editions left by the one of ones",
+			quotas:  `[{"element": "Eyes^laser", "count": 20}]`,
+			extra:   `"oneOfOnes": [{"elements": ["Eyes^laser"]}, {"elements": ["Eyes^plain"]}],`,
+			problem: "19 besides the one of ones is more than the 18 editions of growEditionSizeTo without the 2 one of ones",
+		},
+	}
+
+	for _, c := range cases {
+		config := newTestConfig(t, fmt.Sprintf(`[{
+			"growEditionSizeTo": 20,
+			"layersOrder": %s,
+			%s
+			"quotas": %s
+		}]`, testLayersOrder, c.extra, c.quotas), `{}`)
+
+		_, problems := newTestGenerator(t, config)
+
+		if !strings.Contains(problems.Error(), c.problem) {
+			t.Errorf("%s: problems\n%s\nwant '%s'", c.name, problems, c.problem)
+		}
+	}
+}
+
+// quotas which pass Validate can still be impossible to plan together, Plan fails instead of breaking a count
+func TestPlanQuotasInfeasible(t *testing.T) {
+
+	// all 16 crown combinations are needed, but 4 of them have the gold body which is only in 1 edition
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 20,
+		"layersOrder": `+testLayersOrder+`,
+		"quotas": [
+			{"element": "Hat^crown", "count": 16},
+			{"element": "Body^gold", "max": 1}
+		]
+	}]`, `{}`)
+
+	g := mustTestGenerator(t, config)
+
+	if _, err := g.Plan(1, make(map[string]bool, 0)); err == nil {
+		t.Error("no error for quotas which can not be planned")
+	}
+}
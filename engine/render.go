@@ -0,0 +1,579 @@
+// render
+package engine
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"golips_art_engine/cache"
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// RenderEditions saves the images and the metadata of the planned editions with a pool of workers,
+// returns how many editions are rendered.
+// the first failure cancels the rest of the work, all the failures are returned together
+func (g *Generator) RenderEditions(ctx context.Context, editions []*Edition) (int, error) {
+
+	if !g.validated {
+		return 0, errNotValidated
+	}
+
+	var config = g.config
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer cancel()
+
+	processCount, err := getProcessCount(config.ProcessCount)
+
+	if err != nil {
+		return 0, err
+	}
+
+	g.log.Println("Async Process Count: ", processCount)
+
+	err = g.setupLayerCache(processCount)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if g.debug {
+		defer func() {
+			stats := g.layerCache.Stats()
+			g.log.Printf("[Cache] hits: %d, misses: %d, evictions: %d, images: %d, size: %.1fMB\n", stats.Hits, stats.Misses, stats.Evictions, stats.Items, float64(stats.Size)/1024/1024)
+		}()
+	}
+
+	var (
+		genCount int64 = 0
+
+		jobs    = make(chan *Edition)
+		errChan = make(chan error, len(editions))
+		wg      = sync.WaitGroup{}
+	)
+
+	for i := 0; i < processCount; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ed := range jobs {
+				err := g.renderEdition(ctx, ed)
+
+				switch err {
+				case nil:
+					count := atomic.AddInt64(&genCount, 1)
+
+					if config.LogSettings.ShowGeneratingProgress {
+						g.log.Printf("Generated id: %d (%d/%d)\n", ed.Id, count, len(editions))
+					}
+				case context.Canceled:
+					// stopped by another failure or ctrl+c, it's not a failure itself
+				default:
+					errChan <- fmt.Errorf("edition %d: %s", ed.Id, err)
+					cancel()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, ed := range editions {
+		select {
+		case jobs <- ed:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+
+	// make sure all the render works finish
+	wg.Wait()
+
+	close(errChan)
+
+	var problems ProblemList
+
+	for err := range errChan {
+		problems.addError(err)
+	}
+
+	// canceled from outside, such as ctrl+c
+	if len(problems) == 0 && ctx.Err() != nil && int(genCount) < len(editions) {
+		problems.add("canceled: %s", ctx.Err())
+	}
+
+	return int(genCount), problems.err()
+}
+
+// a number, or "auto" for the number of cpus
+func getProcessCount(processCount models.ProcessCount) (int, error) {
+
+	if processCount == "" {
+		return 1, nil
+	}
+
+	if processCount == "auto" {
+		return runtime.NumCPU(), nil
+	}
+
+	count, err := strconv.Atoi(string(processCount))
+
+	if err != nil {
+		return 0, fmt.Errorf("processCount should be a number or 'auto', got '%s'", processCount)
+	}
+
+	if count < 1 {
+		count = 1
+	}
+
+	return count, nil
+}
+
+// files of an edition are removed if anything goes wrong, so there is never a half edition in the output
+func (g *Generator) renderEdition(ctx context.Context, ed *Edition) (err error) {
+
+	var (
+		config  = g.config
+		written = make([]string, 0)
+	)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	defer func() {
+		if err != nil {
+			for _, path := range written {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	var (
+		animated = false
+		paths    []string
+	)
+
+	if config.Format.Type == formatSvg {
+		paths, err = g.saveSvgEdition(ctx, ed)
+	} else {
+		paths, animated, err = g.saveRasterEdition(ctx, ed)
+	}
+
+	written = append(written, paths...)
+
+	if err != nil {
+		return err
+	}
+
+	if config.MetadataSettings.OutputEthFormat {
+		err = g.saveMetadataErc721(ed.Id, ed.DNA, animated)
+
+		if err != nil {
+			return err
+		}
+
+		written = append(written, g.getMetadataPath(outputMetadataDir, ed.Id))
+	}
+
+	if config.MetadataSettings.OutputSOLFormat {
+		err = g.saveMetadataSolana(ed.Id, ed.DNA, animated)
+
+		if err != nil {
+			return err
+		}
+
+		written = append(written, g.getMetadataPath(outputSolMetadataDir, ed.Id))
+	}
+
+	return nil
+}
+
+// attributes of the metadata: the background, the layers with their tint colors, then the number attributes
+func getAttributes(config *models.Config, dna *DNA) []models.MetaDataAttribute {
+
+	var attributesList = make([]models.MetaDataAttribute, 0)
+
+	// finished images have their own attributes
+	if dna.finished {
+		return append(attributesList, dna.attributes...)
+	}
+
+	// the background is picked with the dna, see planEdition
+	if dna.background != nil {
+		if attr, ok := getBackgroundAttribute(config, dna); ok {
+			attributesList = append(attributesList, attr)
+		}
+	}
+
+	for _, e := range dna.Elements {
+		if e.HideInMetadata {
+			continue
+		}
+
+		if config.MetadataSettings.ShowNoneInMetadata || e.Name != config.MetadataSettings.NoneAttributeName {
+			attributesList = append(attributesList, models.MetaDataAttribute{
+				TraitType: e.BelongLayerName,
+				Value:     e.Name,
+			})
+
+			if attr, ok := getTintAttribute(e); ok {
+				attributesList = append(attributesList, attr)
+			}
+		}
+	}
+
+	return append(attributesList, dna.NumberAttributes...)
+}
+
+// layer images of the dna, and how many frames the edition has.
+// editions with animated layers have more than one frame
+func (g *Generator) loadEditionImages(dna *DNA) ([]image.Image, int, error) {
+
+	var (
+		format     = g.config.Format
+		images     = make([]image.Image, len(dna.Elements))
+		frameCount = 1
+	)
+
+	for i, e := range dna.Elements {
+		img, err := g.loadLayerImage(e, format)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		images[i] = img
+
+		// without an animation type only the first frames are used
+		if format.Animation.Type != "" && getFrameCount(img) > frameCount {
+			frameCount = getFrameCount(img)
+		}
+	}
+
+	return images, frameCount, nil
+}
+
+// animated editions have an animation url in the metadata
+func (g *Generator) isAnimated(dna *DNA) (bool, error) {
+
+	if g.config.Format.Type == formatSvg || g.config.Format.Animation.Type == "" {
+		return false, nil
+	}
+
+	_, frameCount, err := g.loadEditionImages(dna)
+
+	return frameCount > 1, err
+}
+
+// images of an edition, and the animation if it has animated layers.
+// returns the files written before anything goes wrong, so they can be removed
+func (g *Generator) saveRasterEdition(ctx context.Context, ed *Edition) ([]string, bool, error) {
+
+	var (
+		config  = g.config
+		num     = ed.Id
+		written = make([]string, 0)
+	)
+
+	images, frameCount, err := g.loadEditionImages(ed.DNA)
+
+	if err != nil {
+		return written, false, err
+	}
+
+	var (
+		main     = getMainVariant(config)
+		variants = getVariants(config)
+		// the first frame is the still image
+		dst           = drawEditionFrame(config, ed.DNA, images, 0, main)
+		variantImages = make([]image.Image, len(variants))
+	)
+
+	for i, v := range variants {
+		variantImages[i] = cropImage(drawEditionFrame(config, ed.DNA, images, 0, v), getVariantRect(v, config.Format))
+	}
+
+	var frames = []image.Image{dst}
+
+	for frame := 1; frame < frameCount; frame++ {
+		frames = append(frames, drawEditionFrame(config, ed.DNA, images, frame, main))
+	}
+
+	// do not start writing files if the work has been canceled
+	if ctx.Err() != nil {
+		return written, false, ctx.Err()
+	}
+
+	path := g.getImagePath(outputImagesDir, num, config.Format)
+
+	err = g.saveImage(path, dst, config.Format)
+
+	if err != nil {
+		return written, false, err
+	}
+
+	written = append(written, path)
+
+	for i, v := range variants {
+		path = g.getImagePath(getMultiVersionFolderName(v.Name), num, config.Format)
+
+		err = g.saveImage(path, variantImages[i], config.Format)
+
+		if err != nil {
+			return written, false, err
+		}
+
+		written = append(written, path)
+	}
+
+	for _, r := range config.Format.Resolutions {
+		path = g.getImagePath(getResolutionFolderName(r.Name), num, config.Format)
+
+		err = g.saveImage(path, utils.Resize(dst, r.Width, r.Height, config.Format.Smoothing), config.Format)
+
+		if err != nil {
+			return written, false, err
+		}
+
+		written = append(written, path)
+	}
+
+	if len(frames) > 1 {
+		path = g.getAnimationPath(num)
+
+		err = g.saveAnimation(path, frames, config.Format.Animation)
+
+		if err != nil {
+			return written, false, err
+		}
+
+		written = append(written, path)
+	}
+
+	return written, len(frames) > 1, nil
+}
+
+// a new cache for every run, the layers may have changed
+func (g *Generator) setupLayerCache(processCount int) error {
+
+	var config = g.config
+
+	g.layerCache = cache.New(int64(config.CacheSettings.MemoryLimit) * 1024 * 1024)
+
+	// svg documents are made of the layer files, there is no image to load
+	if !config.CacheSettings.Preload || config.Format.Type == formatSvg {
+		return nil
+	}
+
+	var (
+		keys = make([]string, 0)
+		// k-v: cache key - element
+		elements = make(map[string]models.LayerElement, 0)
+	)
+
+	for _, c := range config.LayerConfigurations {
+		for _, layer := range c.LayersOrder {
+			var list = layer.Elements
+
+			for _, k := range getSortedLimitKeys(layer.Limits) {
+				list = append(list, layer.Limits[k]...)
+			}
+
+			// tinted images are loaded with every color of the palette
+			var tints = []*models.ElementTint{nil}
+
+			if layer.Options.Tint != nil {
+				tints = make([]*models.ElementTint, 0)
+
+				for _, c := range layer.Options.Tint.Colors {
+					tints = append(tints, &models.ElementTint{Mode: layer.Options.Tint.Mode, Color: c})
+				}
+			}
+
+			for _, e := range list {
+				e.Placement = getElementPlacement(layer, e.Name)
+
+				for _, tint := range tints {
+					e.Tint = tint
+
+					key := getLayerCacheKey(e)
+
+					if _, exist := elements[key]; !exist {
+						elements[key] = e
+						keys = append(keys, key)
+					}
+				}
+			}
+		}
+	}
+
+	err := g.layerCache.Preload(keys, func(key string) (image.Image, error) {
+		return g.decodeLayerImage(elements[key], config.Format)
+	}, processCount)
+
+	if err != nil {
+		return fmt.Errorf("preload layers: %s", err)
+	}
+
+	stats := g.layerCache.Stats()
+
+	g.log.Printf("Layers Preloaded: %d images, %.1fMB\n", stats.Items, float64(stats.Size)/1024/1024)
+
+	if stats.Evictions > 0 {
+		g.log.Printf("[Warning] cacheSettings.memoryLimit: %dMB is not enough for all the %d layer images, some of them will be decoded again\n", config.CacheSettings.MemoryLimit, len(keys))
+	}
+
+	return nil
+}
+
+// layers are scaled once, the cache keeps the scaled ones
+func (g *Generator) loadLayerImage(e models.LayerElement, format models.OutputFormat) (image.Image, error) {
+	return g.layerCache.Get(getLayerCacheKey(e), func(string) (image.Image, error) {
+		return g.decodeLayerImage(e, format)
+	})
+}
+
+// the same file may be scaled or tinted in different ways by different layers
+func getLayerCacheKey(e models.LayerElement) string {
+	var key = e.Path
+
+	if e.Placement != nil {
+		key += fmt.Sprintf("|scale=%g", getPlacementScale(e.Placement))
+	}
+
+	if e.Tint != nil {
+		key += fmt.Sprintf("|tint=%s:%s", e.Tint.Mode, e.Tint.Color.Name)
+	}
+
+	return key
+}
+
+// images are scaled to the canvas or by the scale of the placement, then tinted.
+// every frame of an animated layer is done the same way
+func (g *Generator) decodeLayerImage(e models.LayerElement, format models.OutputFormat) (image.Image, error) {
+
+	if isSvgFile(e.Path) {
+		return g.decodeSvgLayer(e, format)
+	}
+
+	frames, err := g.decodeLayerFrames(e.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, img := range frames {
+		frames[i] = fitLayerImage(img, e, format)
+	}
+
+	if len(frames) == 1 {
+		return frames[0], nil
+	}
+
+	sheet, err := newLayerFrames(frames)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", e.Path, err)
+	}
+
+	return sheet, nil
+}
+
+func fitLayerImage(img image.Image, e models.LayerElement, format models.OutputFormat) image.Image {
+
+	width, height := getLayerSize(float64(img.Bounds().Dx()), float64(img.Bounds().Dy()), e, format)
+
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+		img = utils.Resize(img, width, height, format.Smoothing)
+	}
+
+	if e.Tint != nil {
+		img = utils.Tint(img, e.Tint.Mode, e.Tint.Color.ColorList)
+	}
+
+	return img
+}
+
+// the size of the canvas, or the size of the image by the scale of the placement
+func getLayerSize(width, height float64, e models.LayerElement, format models.OutputFormat) (int, int) {
+
+	if e.Placement == nil {
+		return format.Width, format.Height
+	}
+
+	scale := getPlacementScale(e.Placement)
+
+	return int(math.Round(width * scale)), int(math.Round(height * scale))
+}
+
+// animated gif and png files have more than one frame
+func (g *Generator) decodeImageFile(path string) ([]image.Image, error) {
+
+	if isSvgFile(path) {
+		img, err := g.decodeSvgFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []image.Image{img}, nil
+	}
+
+	imgFile, err := os.Open(path)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadImage]", err)
+			g.log.Println("[ImagePath]", path)
+		}
+		return nil, err
+	}
+
+	defer imgFile.Close()
+
+	frames, err := utils.DecodeFrames(imgFile)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ParseImage]", err)
+			g.log.Println("[ImagePath]", path)
+		}
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return frames, nil
+}
+
+func (g *Generator) getImagePath(folder string, id int, format models.OutputFormat) string {
+	return filepath.Join(g.outputDir, folder, fmt.Sprintf("%d%s", id, getImageFormat(format).ext))
+}
+
+func (g *Generator) saveImage(path string, img image.Image, format models.OutputFormat) error {
+	err := utils.WriteFileAtomic(path, func(w io.Writer) error {
+		return getImageFormat(format).encode(w, img, format)
+	})
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[CreateImage]", err)
+		}
+		return err
+	}
+
+	return nil
+}
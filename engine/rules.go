@@ -0,0 +1,388 @@
+// rules
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"golips_art_engine/models"
+)
+
+const (
+	ruleRequires = "requires"
+	ruleExcludes = "excludes"
+	ruleNone     = "none"
+	rulePairs    = "pairs"
+)
+
+// an element of a rule
+type ruleElement struct {
+	layer string
+	name  string
+	key   string
+}
+
+// rules of a layer configuration, elements are keyed like limit folders: 'layer^element'.
+// every rule is checked both ways, so it works whatever the order of the layers is
+// 规则会双向检查, 因此与图层的顺序无关
+type ruleSet struct {
+	delimiter string
+	// metadataSettings.noneAttributeName, a layer which must be none can still use it
+	noneName string
+
+	requires   map[string][]ruleElement // k-v: key - elements it needs
+	excludes   map[string][]string      // k-v: key - keys it can not go with
+	forcesNone map[string][]string      // k-v: key - layers which must be none
+	noneBy     map[string][]string      // k-v: layer - keys making it none
+	requiredIn map[string][]string      // k-v: layer - keys needing an element of it
+
+	// every key in the rules, they are part of the state when counting combinations
+	keys map[string]bool
+
+	// k-v: display name - index in layersOrder
+	index map[string]int
+	// k-v: display name - color set, color bases which are picked before other layers
+	bases map[string]string
+	// k-v: display name - names of the elements and the limit elements
+	elements map[string][]string
+}
+
+// nil if the layer configuration has no rule
+func (g *Generator) compileRules(c *models.LayerConfiguration, prefix string) (*ruleSet, ProblemList) {
+
+	var problems ProblemList
+
+	if len(c.Rules) == 0 {
+		return nil, problems
+	}
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	r := g.newRuleSet(c)
+
+	for i, rule := range c.Rules {
+		name := fmt.Sprintf("%s.rules[%d]", prefix, i)
+
+		element, err := r.parseElement(rule.Element)
+
+		if err != nil {
+			field(name+".element", "%s", err)
+		}
+
+		switch rule.Type {
+		case ruleRequires, ruleExcludes, rulePairs:
+			target, err := r.parseElement(rule.Target)
+
+			if err != nil {
+				field(name+".target", "%s", err)
+				continue
+			}
+
+			if element.layer == target.layer {
+				field(name+".target", "'%s' is in the same layer as '%s'", rule.Target, rule.Element)
+				continue
+			}
+
+			if element.key == "" {
+				continue
+			}
+
+			switch rule.Type {
+			case ruleRequires:
+				r.addRequires(element, target)
+			case ruleExcludes:
+				r.excludes[element.key] = append(r.excludes[element.key], target.key)
+				r.excludes[target.key] = append(r.excludes[target.key], element.key)
+			case rulePairs:
+				r.addRequires(element, target)
+				r.addRequires(target, element)
+			}
+
+			r.keys[target.key] = true
+		case ruleNone:
+			if _, exist := r.index[rule.Target]; !exist {
+				field(name+".target", "no layer named '%s'", rule.Target)
+				continue
+			}
+
+			if element.layer == rule.Target {
+				field(name+".target", "'%s' is the layer of '%s'", rule.Target, rule.Element)
+				continue
+			}
+
+			if element.key == "" {
+				continue
+			}
+
+			r.forcesNone[element.key] = append(r.forcesNone[element.key], rule.Target)
+			r.noneBy[rule.Target] = append(r.noneBy[rule.Target], element.key)
+
+			for _, n := range r.elements[rule.Target] {
+				r.keys[r.key(rule.Target, n)] = true
+			}
+		default:
+			field(name+".type", "'%s' should be %s, %s, %s or %s", rule.Type, ruleRequires, ruleExcludes, ruleNone, rulePairs)
+			continue
+		}
+
+		r.keys[element.key] = true
+	}
+
+	return r, problems
+}
+
+// the layers of the layer configuration without any rule, elements of them can be parsed
+func (g *Generator) newRuleSet(c *models.LayerConfiguration) *ruleSet {
+
+	r := &ruleSet{
+		delimiter:  g.limitDelimiter,
+		noneName:   g.config.MetadataSettings.NoneAttributeName,
+		requires:   make(map[string][]ruleElement, 0),
+		excludes:   make(map[string][]string, 0),
+		forcesNone: make(map[string][]string, 0),
+		noneBy:     make(map[string][]string, 0),
+		requiredIn: make(map[string][]string, 0),
+		keys:       make(map[string]bool, 0),
+		index:      make(map[string]int, 0),
+		bases:      make(map[string]string, 0),
+		elements:   make(map[string][]string, 0),
+	}
+
+	for i, layer := range c.LayersOrder {
+		name := layer.Options.DisplayName
+
+		r.index[name] = i
+
+		// tinted bases pick a color, not an element
+		if layer.Options.ColorSet != "" && layer.Options.IsColorBase && layer.Options.Tint == nil {
+			r.bases[name] = layer.Options.ColorSet
+		}
+
+		var list = append([]models.LayerElement{}, layer.Elements...)
+
+		for _, k := range getSortedLimitKeys(layer.Limits) {
+			list = append(list, layer.Limits[k]...)
+		}
+
+		for _, e := range list {
+			r.elements[name] = append(r.elements[name], e.Name)
+		}
+	}
+
+	return r
+}
+
+func (r *ruleSet) key(layer string, name string) string {
+	return layer + r.delimiter + name
+}
+
+// elements are named like limit folders, the layer is the display name
+func (r *ruleSet) parseElement(s string) (ruleElement, error) {
+
+	parts := strings.SplitN(s, r.delimiter, 2)
+
+	if len(parts) != 2 {
+		return ruleElement{}, fmt.Errorf("'%s' should be named like 'layer%selement'", s, r.delimiter)
+	}
+
+	if _, exist := r.index[parts[0]]; !exist {
+		return ruleElement{}, fmt.Errorf("no layer named '%s'", parts[0])
+	}
+
+	if !containsString(r.elements[parts[0]], parts[1]) {
+		return ruleElement{}, fmt.Errorf("no element named '%s' in layer '%s'", parts[1], parts[0])
+	}
+
+	return ruleElement{layer: parts[0], name: parts[1], key: s}, nil
+}
+
+func (r *ruleSet) addRequires(element ruleElement, target ruleElement) {
+	r.requires[element.key] = append(r.requires[element.key], target)
+	r.requiredIn[target.layer] = append(r.requiredIn[target.layer], element.key)
+}
+
+// the same layers without any rule, to tell what the rules change
+func (r *ruleSet) layersOnly() *ruleSet {
+	return &ruleSet{
+		delimiter: r.delimiter,
+		noneName:  r.noneName,
+		index:     r.index,
+		bases:     r.bases,
+		elements:  r.elements,
+	}
+}
+
+// the state of the key matters to the rules, nil rules have no key
+func (r *ruleSet) has(key string) bool {
+	return r != nil && r.keys[key]
+}
+
+// color bases are picked before the other layers, their elements are found by the color sets
+func (r *ruleSet) picked(key string, usedElements map[string]bool, colorSets map[string]string) bool {
+
+	if usedElements[key] {
+		return true
+	}
+
+	for layer, colorSet := range r.bases {
+		if colorSets[colorSet] != "" && r.key(layer, colorSets[colorSet]) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// whether the layer at the index has been picked, color bases are picked first.
+// i is the index of the layer being picked, colorBase is true when the color bases are being picked
+func (r *ruleSet) decided(layer string, i int, colorBase bool) bool {
+
+	j, exist := r.index[layer]
+
+	if !exist {
+		return false
+	}
+
+	_, isBase := r.bases[layer]
+
+	if colorBase {
+		return isBase && j < i
+	}
+
+	return j < i || isBase
+}
+
+// a layer has an element other than the none element
+func (r *ruleSet) hasElement(layer string, usedElements map[string]bool, colorSets map[string]string) bool {
+
+	for _, name := range r.elements[layer] {
+		if name != r.noneName && r.picked(r.key(layer, name), usedElements, colorSets) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// whether the element of the layer at the index can go with the elements picked before it.
+// rules with layers which are not picked yet are left to the later layers, or checked by satisfied at last
+func (r *ruleSet) allows(layer string, name string, i int, colorBase bool, usedElements map[string]bool, colorSets map[string]string) bool {
+
+	if r == nil {
+		return true
+	}
+
+	key := r.key(layer, name)
+
+	for _, e := range r.excludes[key] {
+		if r.picked(e, usedElements, colorSets) {
+			return false
+		}
+	}
+
+	// another element wants this layer to be none
+	if name != r.noneName {
+		for _, k := range r.noneBy[layer] {
+			if r.picked(k, usedElements, colorSets) {
+				return false
+			}
+		}
+	}
+
+	for _, target := range r.forcesNone[key] {
+		if r.decided(target, i, colorBase) && r.hasElement(target, usedElements, colorSets) {
+			return false
+		}
+	}
+
+	for _, e := range r.requires[key] {
+		if r.decided(e.layer, i, colorBase) && !r.picked(e.key, usedElements, colorSets) {
+			return false
+		}
+	}
+
+	// another element needs a different element of this layer
+	for _, k := range r.requiredIn[layer] {
+		if !r.picked(k, usedElements, colorSets) {
+			continue
+		}
+
+		for _, e := range r.requires[k] {
+			if e.layer == layer && e.name != name {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// every element needed by the picked elements is picked, layers may be skipped when nothing can be picked
+func (r *ruleSet) satisfied(usedElements map[string]bool, colorSets map[string]string) bool {
+
+	if r == nil {
+		return true
+	}
+
+	for key, list := range r.requires {
+		if !r.picked(key, usedElements, colorSets) {
+			continue
+		}
+
+		for _, e := range list {
+			if !r.picked(e.key, usedElements, colorSets) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// rules which no dna can follow, and elements of the rules which could be picked without the rules but never with them
+func (g *Generator) validateRules(c *models.LayerConfiguration, rules *ruleSet, count models.CombinationCount, prefix string) ProblemList {
+
+	var problems ProblemList
+
+	if count.Max == 0 {
+		problems.add("%s: %s.rules: the rules can never be satisfied, no dna can be created", g.configPath, prefix)
+		return problems
+	}
+
+	var checked = make(map[string]bool, 0)
+
+	for i, rule := range c.Rules {
+
+		var keys = []string{rule.Element}
+
+		if rule.Type != ruleNone {
+			keys = append(keys, rule.Target)
+		}
+
+		for _, key := range keys {
+			if checked[key] {
+				continue
+			}
+
+			checked[key] = true
+
+			with := g.newCombinationCounter(c, rules)
+			with.forced = map[string]bool{key: true}
+
+			if with.count().Max > 0 {
+				continue
+			}
+
+			without := g.newCombinationCounter(c, rules.layersOnly())
+			without.forced = map[string]bool{key: true}
+
+			if without.count().Max > 0 {
+				problems.add("%s: %s.rules[%d]: '%s' can never be picked because of the rules", g.configPath, prefix, i, key)
+			}
+		}
+	}
+
+	return problems
+}
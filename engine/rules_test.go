@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// combinations of the test layers are counted by hand, every layer has 4 elements
+func TestCombinationsWithRules(t *testing.T) {
+
+	var cases = []struct {
+		name  string
+		rules string
+		want  float64
+	}{
+		{"no rule", `[]`, 64},
+		// crown with laser: 4 bodies
+		{"excludes", `[{"type": "excludes", "element": "Hat^crown", "target": "Eyes^laser"}]`, 60},
+		// halo without gold: 3 bodies x 4 eyes
+		{"requires", `[{"type": "requires", "element": "Hat^halo", "target": "Body^gold"}]`, 52},
+		// crown with laser in 4 bodies, the others have neither: 4 x 3 x 3
+		{"pairs", `[{"type": "pairs", "element": "Hat^crown", "target": "Eyes^laser"}]`, 40},
+		// both of the above: halo needs gold and can't have laser, 4 + 1 x 3 + 4 x 2 x 3
+		{"together", `[{"type": "pairs", "element": "Hat^crown", "target": "Eyes^laser"}, {"type": "requires", "element": "Hat^halo", "target": "Body^gold"}]`, 31},
+	}
+
+	for _, c := range cases {
+		for _, order := range []string{testLayersOrder, `[{"name": "Eyes"}, {"name": "Hat"}, {"name": "Body"}]`} {
+			config := newTestConfig(t, fmt.Sprintf(`[{"growEditionSizeTo": 1, "layersOrder": %s, "rules": %s}]`, order, c.rules), `{}`)
+
+			mustTestGenerator(t, config)
+
+			if got := config.LayerConfigurations[0].Combinations; got.Min != c.want || got.Max != c.want {
+				t.Errorf("%s: %s combinations, want %.0f", c.name, FormatCombinations(got), c.want)
+			}
+		}
+	}
+}
+
+// rules hold in every edition, whatever the order of the layers is
+func TestPlanWithRules(t *testing.T) {
+
+	for _, order := range []string{testLayersOrder, `[{"name": "Eyes"}, {"name": "Hat"}, {"name": "Body"}]`} {
+		config := newTestConfig(t, `[{
+			"growEditionSizeTo": 20,
+			"layersOrder": `+order+`,
+			"rules": [
+				{"type": "pairs", "element": "Hat^crown", "target": "Eyes^laser"},
+				{"type": "requires", "element": "Hat^halo", "target": "Body^gold"}
+			]
+		}]`, `{}`)
+
+		g := mustTestGenerator(t, config)
+
+		for seed := int64(1); seed <= 10; seed++ {
+			editions, err := g.Plan(seed, make(map[string]bool, 0))
+
+			if err != nil {
+				t.Fatalf("seed %d: %s", seed, err)
+			}
+
+			for _, ed := range editions {
+				if hasTestElement(ed, "Hat^crown") != hasTestElement(ed, "Eyes^laser") {
+					t.Errorf("seed %d: edition %d breaks the pairs rule: %s", seed, ed.Id, ed.DNA.Key)
+				}
+
+				if hasTestElement(ed, "Hat^halo") && !hasTestElement(ed, "Body^gold") {
+					t.Errorf("seed %d: edition %d has a halo without gold: %s", seed, ed.Id, ed.DNA.Key)
+				}
+			}
+
+			assertReplay(t, g, seed, editions)
+		}
+	}
+}
+
+func TestRuleProblems(t *testing.T) {
+
+	var cases = []struct {
+		name    string
+		rules   string
+		problem string
+	}{
+		{
+			name:    "never picked",
+			rules:   `[{"type": "requires", "element": "Hat^crown", "target": "Eyes^laser"}, {"type": "excludes", "element": "Hat^crown", "target": "Eyes^laser"}]`,
+			problem: "'Hat^crown' can never be picked because of the rules",
+		},
+		{
+			name:    "same layer",
+			rules:   `[{"type": "excludes", "element": "Hat^crown", "target": "Hat^cap"}]`,
+			problem: "'Hat^cap' is in the same layer as 'Hat^crown'",
+		},
+		{
+			name:    "unknown type",
+			rules:   `[{"type": "likes", "element": "Hat^crown", "target": "Eyes^laser"}]`,
+			problem: "'likes' should be requires, excludes, none or pairs",
+		},
+		{
+			name:    "unknown layer",
+			rules:   `[{"type": "requires", "element": "Mask^full", "target": "Eyes^laser"}]`,
+			problem: "no layer named 'Mask'",
+		},
+	}
+
+	for _, c := range cases {
+		config := newTestConfig(t, fmt.Sprintf(`[{"growEditionSizeTo": 1, "layersOrder": %s, "rules": %s}]`, testLayersOrder, c.rules), `{}`)
+
+		_, problems := newTestGenerator(t, config)
+
+		if !strings.Contains(problems.Error(), c.problem) {
+			t.Errorf("%s: problems\n%s\nwant '%s'", c.name, problems, c.problem)
+		}
+	}
+}
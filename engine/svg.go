@@ -0,0 +1,386 @@
+// svg
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// attributes of a layer root which are set again when it's put into the edition
+var svgReplacedAttrs = map[string]bool{
+	"xmlns":   true,
+	"version": true,
+	"id":      true,
+	"x":       true,
+	"y":       true,
+	"width":   true,
+	"height":  true,
+	"viewBox": true,
+}
+
+func isSvgFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), svgExt)
+}
+
+func (g *Generator) readSvgFragment(path string) (*utils.SVGFragment, error) {
+
+	if f, ok := g.svgFragments.Load(path); ok {
+		return f.(*utils.SVGFragment), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadImage]", err)
+			g.log.Println("[ImagePath]", path)
+		}
+		return nil, err
+	}
+
+	fragment, err := utils.ReadSVGFragment(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	g.svgFragments.Store(path, fragment)
+
+	return fragment, nil
+}
+
+// the layers of an edition which the variant shows are stacked into one svg document,
+// a cropped variant only shows that part of the canvas
+func (g *Generator) buildEditionSvg(dna *DNA, v models.Variant) ([]byte, error) {
+
+	var (
+		config = g.config
+		b      bytes.Buffer
+		width  = config.Format.Width
+		height = config.Format.Height
+		view   = getVariantRect(v, config.Format)
+	)
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="%d %d %d %d">`+"\n", view.Dx(), view.Dy(), view.Min.X, view.Min.Y, view.Dx(), view.Dy())
+
+	if dna.background != nil && variantShows(v, config.Background.TraitName) {
+		dna.background.writeSvg(&b, width, height)
+	}
+
+	for i, e := range dna.Elements {
+		if !dna.shows(v, e.BelongLayerName) {
+			continue
+		}
+
+		fragment, err := g.readSvgFragment(e.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the same size as the layer would have as an image
+		rect := image.Rect(0, 0, width, height)
+
+		if e.Placement != nil {
+			w, h := getLayerSize(fragment.Width, fragment.Height, e, config.Format)
+			rect = getPlacementRect(e.Placement, image.Pt(w, h), rect.Size())
+		}
+
+		b.WriteString("<g")
+
+		if e.Opacity < 1 {
+			fmt.Fprintf(&b, ` opacity="%g"`, e.Opacity)
+		}
+
+		if e.BlendMode != "" && e.BlendMode != utils.BlendNormal {
+			fmt.Fprintf(&b, ` style="mix-blend-mode:%s"`, e.BlendMode)
+		}
+
+		fmt.Fprintf(&b, ">\n<svg x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" viewBox=\"%s\"", rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy(), fragment.ViewBox)
+
+		for _, attr := range fragment.Attrs {
+			if !svgReplacedAttrs[attr[0]] {
+				writeSvgAttr(&b, attr[0], attr[1])
+			}
+		}
+
+		b.WriteString(">")
+
+		// ids of every layer start with its index, so layers with the same ids do not mix up
+		b.Write(utils.PrefixSVGIds(fragment.Content, fmt.Sprintf("l%d-", i)))
+
+		b.WriteString("</svg>\n</g>\n")
+	}
+
+	b.WriteString("</svg>\n")
+
+	return b.Bytes(), nil
+}
+
+// the value is written as it is in the layer file, so it's quoted the same way
+func writeSvgAttr(w io.Writer, name, value string) {
+	if strings.Contains(value, `"`) {
+		fmt.Fprintf(w, ` %s='%s'`, name, value)
+		return
+	}
+
+	fmt.Fprintf(w, ` %s="%s"`, name, value)
+}
+
+// the same background as backgroundFill.draw, gradients are svg gradients
+func (b *backgroundFill) writeSvg(w io.Writer, width, height int) {
+
+	if b.kind == backgroundSolid || len(b.stops) == 1 {
+		fmt.Fprintf(w, `<rect width="%d" height="%d" fill="%s"%s/>`+"\n", width, height, svgColor(b.stops[0]), svgOpacity("fill-opacity", b.stops[0]))
+		return
+	}
+
+	var (
+		cx = float64(width) / 2
+		cy = float64(height) / 2
+	)
+
+	if b.kind == backgroundRadial {
+		fmt.Fprintf(w, `<defs><radialGradient id="background" gradientUnits="userSpaceOnUse" cx="%g" cy="%g" r="%g">`, cx, cy, math.Hypot(cx, cy))
+	} else {
+		var (
+			cos  = math.Cos(b.angle * math.Pi / 180)
+			sin  = math.Sin(b.angle * math.Pi / 180)
+			half = math.Abs(cos)*cx + math.Abs(sin)*cy
+		)
+
+		fmt.Fprintf(w, `<defs><linearGradient id="background" gradientUnits="userSpaceOnUse" x1="%g" y1="%g" x2="%g" y2="%g">`, cx-cos*half, cy-sin*half, cx+cos*half, cy+sin*half)
+	}
+
+	// stops are evenly spaced like utils.GradientColor
+	for i, c := range b.stops {
+		fmt.Fprintf(w, `<stop offset="%g" stop-color="%s"%s/>`, float64(i)/float64(len(b.stops)-1), svgColor(c), svgOpacity("stop-opacity", c))
+	}
+
+	if b.kind == backgroundRadial {
+		io.WriteString(w, "</radialGradient></defs>\n")
+	} else {
+		io.WriteString(w, "</linearGradient></defs>\n")
+	}
+
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="url(#background)"/>`+"\n", width, height)
+}
+
+// alpha is written as an opacity attribute, not every reader knows #rrggbbaa
+func svgColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func svgOpacity(name string, c color.NRGBA) string {
+	if c.A == 255 {
+		return ""
+	}
+
+	return fmt.Sprintf(` %s="%g"`, name, math.Round(float64(c.A)/255*1000)/1000)
+}
+
+// svg documents of an edition, and the raster export with its resolutions.
+// returns the files written before anything goes wrong, so they can be removed
+func (g *Generator) saveSvgEdition(ctx context.Context, ed *Edition) ([]string, error) {
+
+	var (
+		config  = g.config
+		written = make([]string, 0)
+		raster  *image.RGBA
+	)
+
+	doc, err := g.buildEditionSvg(ed.DNA, getMainVariant(config))
+
+	if err != nil {
+		return written, err
+	}
+
+	if config.Format.Raster != "" {
+		raster, err = utils.RasterizeSVG(doc, config.Format.Width, config.Format.Height)
+
+		if err != nil {
+			return written, err
+		}
+	}
+
+	// do not start writing files if the work has been canceled
+	if ctx.Err() != nil {
+		return written, ctx.Err()
+	}
+
+	path := g.getImagePath(outputImagesDir, ed.Id, config.Format)
+
+	err = g.saveSvg(path, doc)
+
+	if err != nil {
+		return written, err
+	}
+
+	written = append(written, path)
+
+	for _, v := range getVariants(config) {
+		variantDoc, err := g.buildEditionSvg(ed.DNA, v)
+
+		if err != nil {
+			return written, err
+		}
+
+		path = g.getImagePath(getMultiVersionFolderName(v.Name), ed.Id, config.Format)
+
+		err = g.saveSvg(path, variantDoc)
+
+		if err != nil {
+			return written, err
+		}
+
+		written = append(written, path)
+	}
+
+	if raster == nil {
+		return written, nil
+	}
+
+	rasterFormat := getRasterFormat(config.Format)
+
+	path = g.getImagePath(outputRasterDir, ed.Id, rasterFormat)
+
+	err = g.saveImage(path, raster, rasterFormat)
+
+	if err != nil {
+		return written, err
+	}
+
+	written = append(written, path)
+
+	// resolutions are resized from the raster export
+	for _, r := range config.Format.Resolutions {
+		path = g.getImagePath(getResolutionFolderName(r.Name), ed.Id, rasterFormat)
+
+		err = g.saveImage(path, utils.Resize(raster, r.Width, r.Height, config.Format.Smoothing), rasterFormat)
+
+		if err != nil {
+			return written, err
+		}
+
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+func (g *Generator) saveSvg(path string, doc []byte) error {
+	err := utils.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(doc)
+		return err
+	})
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[CreateImage]", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// svg layers are drawn at the size they are used, so they are never scaled as images
+func (g *Generator) decodeSvgLayer(e models.LayerElement, format models.OutputFormat) (image.Image, error) {
+
+	data, err := ioutil.ReadFile(e.Path)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadImage]", err)
+			g.log.Println("[ImagePath]", e.Path)
+		}
+		return nil, err
+	}
+
+	width, height, err := utils.SVGSize(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", e.Path, err)
+	}
+
+	w, h := getLayerSize(width, height, e, format)
+
+	var img image.Image
+
+	img, err = utils.RasterizeSVG(data, w, h)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", e.Path, err)
+	}
+
+	if e.Tint != nil {
+		img = utils.Tint(img, e.Tint.Mode, e.Tint.Color.ColorList)
+	}
+
+	return img, nil
+}
+
+// svg files which are not layers, such as frames, are drawn at their own size
+func (g *Generator) decodeSvgFile(path string) (image.Image, error) {
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		if g.debug {
+			g.log.Println("[ReadImage]", err)
+			g.log.Println("[ImagePath]", path)
+		}
+		return nil, err
+	}
+
+	width, height, err := utils.SVGSize(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	img, err := utils.RasterizeSVG(data, int(math.Ceil(width)), int(math.Ceil(height)))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return img, nil
+}
+
+// svg documents are made of svg layers, and they can not be tinted
+func (g *Generator) validateSvgLayers(c *models.LayerConfiguration, prefix string) ProblemList {
+
+	var problems ProblemList
+
+	for i, layer := range c.LayersOrder {
+		if layer.Options.Tint != nil {
+			problems.add("%s: %s.layersOrder[%d].options.tint: svg layers can not be tinted, please use colored svg files", g.configPath, prefix, i)
+		}
+
+		var list = layer.Elements
+
+		for _, k := range getSortedLimitKeys(layer.Limits) {
+			list = append(list, layer.Limits[k]...)
+		}
+
+		for _, e := range list {
+			if !isSvgFile(e.Path) {
+				problems.add("%s: format.type is svg, every layer should be an svg file", e.Path)
+			}
+		}
+	}
+
+	return problems
+}
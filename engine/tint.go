@@ -0,0 +1,111 @@
+// tint
+package engine
+
+import (
+	"math/rand"
+
+	"golips_art_engine/models"
+)
+
+// pick a color of the tint palette by weight, the rules may leave some colors out of the list.
+// colors of weight 0 are never picked, false if no color is left
+func pickTintColor(colors []models.TintColor, rng *rand.Rand) (models.TintColor, bool) {
+
+	var (
+		totalWeight float64 = 0
+		list                = make([]models.TintColor, 0)
+	)
+
+	for _, c := range colors {
+		if c.Weight <= 0 {
+			continue
+		}
+
+		totalWeight += c.Weight
+		list = append(list, c)
+	}
+
+	if len(list) == 0 {
+		return models.TintColor{}, false
+	}
+
+	target := rng.Float64() * totalWeight
+
+	for _, c := range list {
+		target -= c.Weight
+
+		if target < 0 {
+			return c, true
+		}
+	}
+
+	return list[len(list)-1], true
+}
+
+// layers in a color set use the color of the set, so they match the other layers.
+// nil if the layer is not tinted, or the palette has no color of the set
+// 色彩集合中的图层使用集合的颜色, 与其他图层保持一致
+func getElementTint(layer models.LayerOrder, colorSets map[string]string, rng *rand.Rand) *models.ElementTint {
+
+	var tint = layer.Options.Tint
+
+	if tint == nil {
+		return nil
+	}
+
+	et := &models.ElementTint{
+		Mode:      tint.Mode,
+		TraitName: tint.TraitName,
+	}
+
+	if layer.Options.ColorSet == "" {
+		color, ok := pickTintColor(tint.Colors, rng)
+
+		if !ok {
+			return nil
+		}
+
+		et.Color = color
+		return et
+	}
+
+	for _, c := range tint.Colors {
+		if c.Name == colorSets[layer.Options.ColorSet] {
+			et.Color = c
+			return et
+		}
+	}
+
+	return nil
+}
+
+func getTintAttribute(e models.LayerElement) (models.MetaDataAttribute, bool) {
+
+	if e.Tint == nil || e.HideInMetadata {
+		return models.MetaDataAttribute{}, false
+	}
+
+	return models.MetaDataAttribute{
+		TraitType: e.Tint.TraitName,
+		Value:     e.Tint.Color.Name,
+	}, true
+}
+
+// names of the colors a layer may be tinted with, when it picks the color itself.
+// nil for layers which are not tinted or follow a color set
+func getFreeTintColors(layer models.LayerOrder) []models.TintColor {
+
+	if layer.Options.Tint == nil || layer.Options.ColorSet != "" {
+		return nil
+	}
+
+	var list = make([]models.TintColor, 0)
+
+	for _, c := range layer.Options.Tint.Colors {
+		if c.Weight > 0 {
+			list = append(list, c)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// the hat follows the color of the tinted skin, only the blue cap goes with the gold body
+var testTintLayers = map[string][]string{
+	"Skin": {"skin"},
+	"Body": {"gold"},
+	"Hat":  {"red$crown", "blue$cap"},
+}
+
+func TestPickTintColor(t *testing.T) {
+
+	var colors = newTestConfig(t, `[{
+		"growEditionSizeTo": 1,
+		"layersOrder": [{"name": "Skin", "options": {"tint": {"colors": [
+			{"name": "red", "weight": 10, "color": "#ff0000"},
+			{"name": "blue", "weight": 0, "color": "#0000ff"}
+		]}}}]
+	}]`, `{}`).LayerConfigurations[0].LayersOrder[0].Options.Tint.Colors
+
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		if c, ok := pickTintColor(colors, rng); !ok || c.Name != "red" {
+			t.Fatalf("picked '%s', want red", c.Name)
+		}
+	}
+
+	if _, ok := pickTintColor(colors[1:], rng); ok {
+		t.Error("a color of weight 0 is picked")
+	}
+
+	if _, ok := pickTintColor(nil, rng); ok {
+		t.Error("a color is picked from an empty palette")
+	}
+}
+
+// the rule leaves only the blue skin of weight 0, which is not in the counted combinations
+func TestTintedColorBaseOfWeightZero(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 1,
+		"layersOrder": [
+			{"name": "Skin", "options": {"isColorBase": true, "colorSet": "skin", "tint": {"colors": [
+				{"name": "red", "weight": 10, "color": "#ff0000"},
+				{"name": "blue", "weight": 0, "color": "#0000ff"}
+			]}}},
+			{"name": "Body"},
+			{"name": "Hat", "options": {"colorSet": "skin"}}
+		],
+		"rules": [{"type": "requires", "element": "Body^gold", "target": "Hat^cap"}]
+	}]`, `{}`)
+
+	g, problems := newTestGeneratorWithLayers(t, config, testTintLayers)
+
+	if !strings.Contains(problems.Error(), "the rules can never be satisfied") {
+		t.Fatalf("problems\n%s\nwant the rules can never be satisfied", problems)
+	}
+
+	var c = &config.LayerConfigurations[0]
+
+	for seed := int64(1); seed <= 10; seed++ {
+		_, elements := g.createDNA(c, g.counters[0], rand.New(rand.NewSource(seed)))
+
+		for _, e := range elements {
+			if e.Tint != nil && e.Tint.Color.Weight <= 0 {
+				t.Errorf("seed %d: '%s' is tinted with '%s' of weight 0", seed, e.Name, e.Tint.Color.Name)
+			}
+
+			if e.Name == "cap" {
+				t.Errorf("seed %d: the cap of the blue skin is picked", seed)
+			}
+		}
+	}
+}
@@ -0,0 +1,863 @@
+// validate
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golips_art_engine/models"
+	"golips_art_engine/utils"
+)
+
+// ProblemList is the problems found in config and layers, so they can be reported all at once
+type ProblemList []string
+
+func (l ProblemList) Error() string {
+	return strings.Join(l, "\n")
+}
+
+func (l *ProblemList) add(format string, a ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, a...))
+}
+
+func (l *ProblemList) addError(err error) {
+	if list, ok := err.(ProblemList); ok {
+		*l = append(*l, list...)
+		return
+	}
+
+	*l = append(*l, err.Error())
+}
+
+// nil if there is no problem, so it can be returned as an error directly
+func (l ProblemList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// Validate checks the config against the layers folder before any image is drawn,
+// elements of every layer are read into the config at the same time.
+// warnings won't stop the generating, but it may be slow or fail halfway
+// 在绘制任何图片之前根据图层文件夹检查配置, 同时将每个图层的元素读取到配置中
+func (g *Generator) Validate() (ProblemList, ProblemList) {
+
+	var (
+		config = g.config
+
+		problems ProblemList
+		warnings ProblemList
+
+		// batches with the same layers share the same combinations, as dna is checked across batches
+		// k-v: layers of batch - batches
+		sameLayers      = make(map[string][]int, 0)
+		sameLayersOrder = make([]string, 0)
+	)
+
+	g.counters = make([]*combinationCounter, len(config.LayerConfigurations))
+	g.quotas = make([]*quotaSet, len(config.LayerConfigurations))
+	g.quotaPlans = make([]*quotaPlan, len(config.LayerConfigurations))
+	g.plannedIds = nil
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	if config.Format.Width <= 0 || config.Format.Height <= 0 {
+		field("format", "width and height should be greater than 0")
+	}
+
+	var resolutionNames = make(map[string]bool, 0)
+
+	for i, r := range config.Format.Resolutions {
+		name := fmt.Sprintf("format.resolutions[%d]", i)
+
+		if r.Width <= 0 || r.Height <= 0 {
+			field(name, "width and height should be greater than 0")
+		}
+
+		switch {
+		case r.Name == "" || strings.ContainsAny(r.Name, `/\`):
+			field(name+".name", "'%s' can not be used as a folder name", r.Name)
+		case resolutionNames[r.Name]:
+			field(name+".name", "'%s' is used by another resolution", r.Name)
+		case r.Name == config.MultiVersionSettings.LayerName:
+			field(name+".name", "'%s' is used by multiVersionSettings.layerName, they share the same folder", r.Name)
+		case getResolutionFolderName(r.Name) == outputRasterDir && config.Format.Raster != "":
+			field(name+".name", "'%s' is used by format.raster, they share the same folder", r.Name)
+		}
+
+		resolutionNames[r.Name] = true
+	}
+
+	problems = append(problems, g.validateFormat(&config.Format)...)
+
+	if config.Format.Type == formatJpeg && !config.Background.Generate {
+		warnings.add("%s: format.type: jpeg has no transparency, transparent pixels will be black without background.generate", g.configPath)
+	}
+
+	if config.Format.Raster == formatJpeg && !config.Background.Generate {
+		warnings.add("%s: format.raster: jpeg has no transparency, transparent pixels will be black without background.generate", g.configPath)
+	}
+
+	// apng files are named like png files, solana metadata uses the file names only
+	if config.Format.Animation.Type != "" && getAnimationFormat(config.Format.Animation).ext == getImageFormat(config.Format).ext && (getAnimationBaseUri(config) == config.BaseUri || config.MetadataSettings.OutputSOLFormat) {
+		warnings.add("%s: format.animation.baseUri: animations and images have the same file names, please upload them to different uris", g.configPath)
+	}
+
+	problems = append(problems, g.validateBackground(&config.Background)...)
+
+	if _, err := getProcessCount(config.ProcessCount); err != nil {
+		field("processCount", "'%s' is not a number or 'auto'", config.ProcessCount)
+	}
+
+	if config.CacheSettings.MemoryLimit < 0 {
+		field("cacheSettings.memoryLimit", "should not be negative, 0 means no limit")
+	}
+
+	for i, v := range config.MetadataSettings.NumberAttributes {
+		if v.Name == "" {
+			field(fmt.Sprintf("metadataSettings.numberAttributes[%d].name", i), "should not be empty")
+		}
+
+		if v.MaxValue <= v.MinValue {
+			field(fmt.Sprintf("metadataSettings.numberAttributes[%d]", i), "maxValue %d should be greater than minValue %d", v.MaxValue, v.MinValue)
+		}
+	}
+
+	if config.MetadataSettings.OutputSOLFormat {
+		var shares int64 = 0
+
+		for _, c := range config.SolanaMetadata.Creators {
+			share, _ := c.Share.Int64()
+			shares += share
+		}
+
+		if shares != 100 {
+			field("solanaMetadata.creators", "shares add up to %d instead of 100", shares)
+		}
+	}
+
+	if len(config.LayerConfigurations) == 0 {
+		field("layerConfigurations", "at least one layer configuration is needed")
+	}
+
+	var (
+		multiVersionFound = config.MultiVersionSettings.LayerName == ""
+		// display names of the layers of all the batches, for variants
+		layerNames = make(map[string]bool, 0)
+	)
+
+	for batch, _ := range config.LayerConfigurations {
+
+		var (
+			c      = &config.LayerConfigurations[batch]
+			prefix = fmt.Sprintf("layerConfigurations[%d]", batch)
+		)
+
+		// count is another name of growEditionSizeTo
+		switch {
+		case c.Count < 0:
+			field(prefix+".count", "should be greater than 0")
+		case c.Count > 0 && c.GrowEditionSizeTo > 0 && c.Count != c.GrowEditionSizeTo:
+			field(prefix+".count", "%d is not the %d of growEditionSizeTo, only one of them is needed", c.Count, c.GrowEditionSizeTo)
+		case c.Count > 0:
+			c.GrowEditionSizeTo = c.Count
+		case c.GrowEditionSizeTo <= 0:
+			field(prefix+".growEditionSizeTo", "should be greater than 0")
+		}
+
+		if c.StartId < 0 {
+			field(prefix+".startId", "should not be negative")
+		}
+
+		if len(c.LayersOrder) == 0 {
+			field(prefix+".layersOrder", "at least one layer is needed")
+			continue
+		}
+
+		var missing = false
+
+		for i, layer := range c.LayersOrder {
+			info, err := os.Stat(filepath.Join(g.layersDir, layer.Name))
+
+			if err != nil || !info.IsDir() {
+				field(fmt.Sprintf("%s.layersOrder[%d].name", prefix, i), "no folder named '%s' under %s", layer.Name, g.layersDir)
+				missing = true
+			}
+		}
+
+		err := g.layersSetup(c)
+
+		if err != nil {
+			problems.addError(err)
+		}
+
+		layerProblems, layerWarnings := g.validateLayers(c, prefix)
+
+		problems = append(problems, layerProblems...)
+		warnings = append(warnings, layerWarnings...)
+
+		if config.Format.Type == formatSvg {
+			problems = append(problems, g.validateSvgLayers(c, prefix)...)
+		}
+
+		rules, ruleProblems := g.compileRules(c, prefix)
+
+		problems = append(problems, ruleProblems...)
+
+		quotas, quotaProblems := g.compileQuotas(c, rules, prefix)
+
+		problems = append(problems, quotaProblems...)
+
+		for i, layer := range c.LayersOrder {
+			if layer.Options.DisplayName == config.MultiVersionSettings.LayerName {
+				multiVersionFound = true
+			}
+
+			layerNames[layer.Options.DisplayName] = true
+
+			if config.Background.Generate && (showBackgroundInMetadata(config.Background) || usePalettes(config.Background)) && layer.Options.DisplayName == config.Background.TraitName {
+				field(fmt.Sprintf("%s.layersOrder[%d]", prefix, i), "display name '%s' is used by background.traitName, please set another traitName or turn off background.showInMetadata", layer.Options.DisplayName)
+			}
+		}
+
+		// the number is meaningless without all the layers
+		if missing {
+			continue
+		}
+
+		counter := g.newCombinationCounter(c, rules)
+
+		c.Combinations = counter.count()
+
+		// createDNA asks the counter which elements follow the rules
+		if rules != nil {
+			g.counters[batch] = counter
+
+			if len(ruleProblems) == 0 {
+				problems = append(problems, g.validateRules(c, rules, c.Combinations, prefix)...)
+			}
+		}
+
+		problems = append(problems, g.validateOneOfOnes(c, batch, prefix)...)
+
+		if quotas != nil && len(ruleProblems) == 0 && len(quotaProblems) == 0 {
+			g.quotas[batch] = quotas
+
+			problems = append(problems, g.validateQuotas(c, quotas, prefix)...)
+		}
+
+		// every palette goes with every combination of layers
+		c.Combinations.Min *= countPalettes(config.Background)
+		c.Combinations.Max *= countPalettes(config.Background)
+
+		signature, _ := json.Marshal([]interface{}{c.LayersOrder, c.ConflictElements, c.Rules})
+
+		if _, exist := sameLayers[string(signature)]; !exist {
+			sameLayersOrder = append(sameLayersOrder, string(signature))
+		}
+
+		sameLayers[string(signature)] = append(sameLayers[string(signature)], batch)
+	}
+
+	for _, signature := range sameLayersOrder {
+
+		var (
+			batches      = sameLayers[signature]
+			c            = config.LayerConfigurations[batches[0]]
+			editionCount = 0
+			names        = make([]string, 0)
+		)
+
+		for _, batch := range batches {
+			editionCount += config.LayerConfigurations[batch].GrowEditionSizeTo
+			names = append(names, fmt.Sprintf("layerConfigurations[%d]", batch))
+		}
+
+		name := strings.Join(names, " + ")
+
+		if float64(editionCount) > c.Combinations.Max {
+			field(name+".growEditionSizeTo", "%d editions are more than the %s possible combinations", editionCount, FormatCombinations(c.Combinations))
+		} else if float64(editionCount) > c.Combinations.Min*combinationsWarningRate {
+			warnings.add("%s: %s.growEditionSizeTo: %d editions take %.1f%% of the %s possible combinations, generating may fail with too many duplicates", g.configPath, name, editionCount, CombinationsUsed(editionCount, c.Combinations), FormatCombinations(c.Combinations))
+		}
+	}
+
+	problems = append(problems, g.validateIds()...)
+
+	if !multiVersionFound {
+		field("multiVersionSettings.layerName", "no layer named '%s'", config.MultiVersionSettings.LayerName)
+	}
+
+	problems = append(problems, g.validateVariants(layerNames)...)
+
+	g.validated = len(problems) == 0
+
+	return problems, warnings
+}
+
+// no two batches should have the same id, or their files are written over each other
+func (g *Generator) validateIds() ProblemList {
+
+	var (
+		problems ProblemList
+		batches  = g.config.LayerConfigurations
+	)
+
+	for j := 1; j < len(batches); j++ {
+		if batches[j].GrowEditionSizeTo <= 0 || batches[j].StartId < 0 {
+			continue
+		}
+
+		first, last := g.getFirstId(j), g.getFirstId(j)+batches[j].GrowEditionSizeTo-1
+
+		for i := 0; i < j; i++ {
+			if batches[i].GrowEditionSizeTo <= 0 || batches[i].StartId < 0 {
+				continue
+			}
+
+			otherFirst, otherLast := g.getFirstId(i), g.getFirstId(i)+batches[i].GrowEditionSizeTo-1
+
+			if first <= otherLast && otherFirst <= last {
+				problems.add("%s: layerConfigurations[%d].startId: ids %d ~ %d overlap the ids %d ~ %d of layerConfigurations[%d]", g.configPath, j, first, last, otherFirst, otherLast, i)
+			}
+		}
+	}
+
+	return problems
+}
+
+// the image type is checked and the defaults are filled, such as png and the jpeg quality
+func (g *Generator) validateFormat(format *models.OutputFormat) ProblemList {
+
+	var problems ProblemList
+
+	field := func(name string, f string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(f, a...))
+	}
+
+	switch strings.ToLower(format.Type) {
+	case "", formatPng:
+		format.Type = formatPng
+	case formatJpeg, "jpg":
+		format.Type = formatJpeg
+	case formatWebp:
+		format.Type = formatWebp
+	case formatSvg:
+		format.Type = formatSvg
+	default:
+		field("format.type", "'%s' should be png, jpeg, webp or svg", format.Type)
+	}
+
+	switch strings.ToLower(format.Raster) {
+	case "":
+	case formatPng:
+		format.Raster = formatPng
+	case formatJpeg, "jpg":
+		format.Raster = formatJpeg
+	case formatWebp:
+		format.Raster = formatWebp
+	default:
+		field("format.raster", "'%s' should be png, jpeg or webp", format.Raster)
+	}
+
+	if format.Type == formatSvg {
+		if format.Animation.Type != "" {
+			field("format.animation.type", "svg images can not be animated")
+		}
+
+		// other images are resized from the main images
+		if len(format.Resolutions) > 0 && format.Raster == "" {
+			field("format.resolutions", "svg images are resized from the raster export, format.raster is needed")
+		}
+	} else if format.Raster != "" {
+		field("format.raster", "only svg images have a raster export, format.type is %s", format.Type)
+	}
+
+	if _, ok := pngCompressionLevels[format.Compression]; !ok {
+		field("format.compression", "'%s' should be default, none, speed or best", format.Compression)
+	}
+
+	if format.Quality == 0 {
+		format.Quality = jpeg.DefaultQuality
+	}
+
+	if format.Quality < 1 || format.Quality > 100 {
+		field("format.quality", "%d should be 1 ~ 100", format.Quality)
+	}
+
+	switch strings.ToLower(format.Animation.Type) {
+	case "":
+	case animationGif:
+		format.Animation.Type = animationGif
+	case animationApng:
+		format.Animation.Type = animationApng
+	default:
+		field("format.animation.type", "'%s' should be gif or apng", format.Animation.Type)
+	}
+
+	if format.Animation.Delay == 0 {
+		format.Animation.Delay = defaultAnimationDelay
+	}
+
+	// apng saves the delay in 16 bits
+	if format.Animation.Delay < 0 || format.Animation.Delay > math.MaxUint16 {
+		field("format.animation.delay", "%d should be 1 ~ %d", format.Animation.Delay, math.MaxUint16)
+	}
+
+	if format.Animation.Plays < 0 || format.Animation.Plays > math.MaxUint16 {
+		field("format.animation.plays", "%d should be 0 ~ %d, 0 means forever", format.Animation.Plays, math.MaxUint16)
+	}
+
+	if format.Type == formatWebp || format.Raster == formatWebp {
+		if format.Width > webpMaxSize || format.Height > webpMaxSize {
+			field("format", "webp images can not be bigger than %dx%d", webpMaxSize, webpMaxSize)
+		}
+
+		for i, r := range format.Resolutions {
+			if r.Width > webpMaxSize || r.Height > webpMaxSize {
+				field(fmt.Sprintf("format.resolutions[%d]", i), "webp images can not be bigger than %dx%d", webpMaxSize, webpMaxSize)
+			}
+		}
+	}
+
+	return problems
+}
+
+// background colors are read into the config, such as brightness, default color and palette colors
+func (g *Generator) validateBackground(background *models.Background) ProblemList {
+
+	var problems ProblemList
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	if background.TraitName == "" {
+		background.TraitName = defaultBackgroundTraitName
+	}
+
+	if !background.Generate {
+		return problems
+	}
+
+	if background.Static {
+		c, err := utils.ParseHexColor(background.Default)
+
+		if err != nil {
+			field("background.default", "%s", err)
+		}
+
+		background.DefaultColor = c
+
+		if len(background.Palettes) > 0 {
+			field("background.static", "can not be used together with background.palettes")
+		}
+	} else if len(background.Palettes) == 0 {
+		brightness, err := g.getBrightnessNum(background.Brightness)
+
+		if err != nil {
+			field("background.brightness", "'%s' is not a percentage", background.Brightness)
+		}
+
+		background.BrightnessNum = brightness
+	}
+
+	var names = make(map[string]bool, 0)
+
+	for i, _ := range background.Palettes {
+
+		var (
+			p      = &background.Palettes[i]
+			prefix = fmt.Sprintf("background.palettes[%d]", i)
+		)
+
+		if p.Name == "" {
+			field(prefix+".name", "should not be empty")
+		} else if names[p.Name] {
+			field(prefix+".name", "'%s' is used by another palette", p.Name)
+		}
+
+		names[p.Name] = true
+
+		if p.Weight <= 0 {
+			field(prefix+".weight", "should be greater than 0")
+		}
+
+		if p.Type == "" {
+			p.Type = backgroundSolid
+		}
+
+		if p.Type != backgroundSolid && p.Type != backgroundLinear && p.Type != backgroundRadial {
+			field(prefix+".type", "'%s' should be %s, %s or %s", p.Type, backgroundSolid, backgroundLinear, backgroundRadial)
+		}
+
+		p.ColorList = make([]color.NRGBA, 0)
+
+		for j, hex := range p.Colors {
+			c, err := utils.ParseHexColor(hex)
+
+			if err != nil {
+				field(fmt.Sprintf("%s.colors[%d]", prefix, j), "%s", err)
+			}
+
+			p.ColorList = append(p.ColorList, c)
+		}
+
+		if p.Type != backgroundSolid && len(p.Colors) == 1 {
+			field(prefix+".colors", "a gradient needs at least 2 colors")
+		}
+
+		if p.Stops == 0 {
+			p.Stops = defaultGradientStops
+		}
+
+		if p.Type != backgroundSolid && len(p.Colors) == 0 && p.Stops < 2 {
+			field(prefix+".stops", "a gradient needs at least 2 stops")
+		}
+
+		if p.Saturation == nil {
+			p.Saturation = []float64{100, 100}
+		}
+
+		if p.Lightness == nil {
+			p.Lightness = []float64{50, 50}
+		}
+
+		if !isPercentRange(p.Saturation) {
+			field(prefix+".saturation", "should be [min, max] between 0 and 100")
+		}
+
+		if !isPercentRange(p.Lightness) {
+			field(prefix+".lightness", "should be [min, max] between 0 and 100")
+		}
+	}
+
+	return problems
+}
+
+func isPercentRange(r []float64) bool {
+	return len(r) == 2 && r[0] >= 0 && r[0] <= r[1] && r[1] <= 100
+}
+
+// FormatCombinations shows the number of combinations, or the bounds of it
+func FormatCombinations(count models.CombinationCount) string {
+	if count.Min == count.Max {
+		return fmt.Sprintf("%.0f", count.Max)
+	}
+
+	return fmt.Sprintf("%.0f ~ %.0f", count.Min, count.Max)
+}
+
+// CombinationsUsed is the percentage of the combinations taken by the editions, against the least count.
+// bypassDNA layers can make the least count 0, then the most count is used
+func CombinationsUsed(editions int, count models.CombinationCount) float64 {
+	switch {
+	case count.Min > 0:
+		return float64(editions) / count.Min * 100
+	case count.Max > 0:
+		return float64(editions) / count.Max * 100
+	default:
+		return 0
+	}
+}
+
+// check elements, color sets, limits and conflicts of a layer configuration, layers should be set up first.
+// conflicts matching no element are warnings, they never stop an element so the collection is the same
+func (g *Generator) validateLayers(c *models.LayerConfiguration, prefix string) (ProblemList, ProblemList) {
+
+	var (
+		problems ProblemList
+		warnings ProblemList
+
+		field = func(name string, format string, a ...interface{}) {
+			problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+		}
+
+		// k-v: display name - element names
+		layerElements = make(map[string]map[string]bool, 0)
+		allElements   = make(map[string]bool, 0)
+		// k-v: color set - has color base
+		colorSets = make(map[string]bool, 0)
+	)
+
+	for i, layer := range c.LayersOrder {
+
+		var (
+			name     = layer.Options.DisplayName
+			elements = make(map[string]bool, 0)
+		)
+
+		if _, exist := layerElements[name]; exist {
+			field(fmt.Sprintf("%s.layersOrder[%d]", prefix, i), "display name '%s' is used by another layer", name)
+		}
+
+		// elements are nil when the folder is missing, which is reported already
+		if layer.Elements != nil && len(layer.Elements) == 0 {
+			field(fmt.Sprintf("%s.layersOrder[%d].name", prefix, i), "no element found in %s", filepath.Join(g.layersDir, layer.Name))
+		}
+
+		if !utils.IsBlendMode(layer.Options.BlendMode) {
+			field(fmt.Sprintf("%s.layersOrder[%d].options.blendMode", prefix, i), "unknown blend mode '%s'", layer.Options.BlendMode)
+		}
+
+		if opacity := getLayerOpacity(layer.Options); opacity < 0 || opacity > 1 {
+			field(fmt.Sprintf("%s.layersOrder[%d].options.opacity", prefix, i), "should be between 0 and 1")
+		}
+
+		if err := validatePlacement(layer.Options.Placement); err != nil {
+			field(fmt.Sprintf("%s.layersOrder[%d].options", prefix, i), "%s", err)
+		}
+
+		if layer.Options.Tint != nil {
+			problems = append(problems, g.validateTint(layer, fmt.Sprintf("%s.layersOrder[%d].options.tint", prefix, i))...)
+		}
+
+		if layer.Options.IsColorBase && layer.Options.ColorSet == "" {
+			field(fmt.Sprintf("%s.layersOrder[%d].options.isColorBase", prefix, i), "a color base should have a colorSet")
+		}
+
+		if layer.Options.ColorSet != "" {
+			colorSets[layer.Options.ColorSet] = colorSets[layer.Options.ColorSet] || layer.Options.IsColorBase
+		}
+
+		var list = layer.Elements
+
+		for _, limitList := range layer.Limits {
+			list = append(list, limitList...)
+		}
+
+		for _, e := range list {
+			elements[e.Name] = true
+			allElements[e.Name] = true
+
+			if layer.Options.ColorSet != "" && !layer.Options.IsColorBase && layer.Options.Tint == nil && e.Color == "" {
+				problems.add("%s: no color found in the file name, it will never be used in color set '%s'", e.Path, layer.Options.ColorSet)
+			}
+
+			if e.Weight < 0 {
+				problems.add("%s: rarity weight should not be negative", e.Path)
+			}
+
+			err := g.checkImageFile(e.Path)
+
+			if err != nil {
+				problems.add("%s: %s", e.Path, err)
+			}
+		}
+
+		layerElements[name] = elements
+
+		var placed = make([]string, 0)
+
+		for elementName, _ := range layer.Options.Elements {
+			placed = append(placed, elementName)
+		}
+
+		sort.Strings(placed)
+
+		for _, elementName := range placed {
+			if layer.Elements != nil && !elements[elementName] {
+				field(fmt.Sprintf("%s.layersOrder[%d].options.elements[%s]", prefix, i, elementName), "no element named '%s' in this layer", elementName)
+			}
+
+			if err := validatePlacement(layer.Options.Elements[elementName]); err != nil {
+				field(fmt.Sprintf("%s.layersOrder[%d].options.elements[%s]", prefix, i, elementName), "%s", err)
+			}
+		}
+	}
+
+	for i, layer := range c.LayersOrder {
+
+		var limits = make([]string, 0)
+
+		for limit, _ := range layer.Limits {
+			limits = append(limits, limit)
+		}
+
+		sort.Strings(limits)
+
+		for _, limit := range limits {
+			parts := strings.SplitN(limit, g.limitDelimiter, 2)
+
+			if len(parts) != 2 || !layerElements[parts[0]][parts[1]] {
+				problems.add("%s: limit folder matches no element, it should be named like 'layer%selement'", filepath.Join(g.layersDir, layer.Name, limit), g.limitDelimiter)
+				continue
+			}
+
+			if parts[0] == layer.Options.DisplayName {
+				field(fmt.Sprintf("%s.layersOrder[%d]", prefix, i), "limit folder '%s' points to its own layer", limit)
+			}
+		}
+	}
+
+	for colorSet, hasBase := range colorSets {
+		if !hasBase {
+			field(prefix+".layersOrder", "color set '%s' has no layer with isColorBase", colorSet)
+		}
+	}
+
+	var conflictKeys = make([]string, 0)
+
+	for key, _ := range c.ConflictElements {
+		conflictKeys = append(conflictKeys, key)
+	}
+
+	sort.Strings(conflictKeys)
+
+	for _, key := range conflictKeys {
+		conflicts := c.ConflictElements[key]
+
+		if !allElements[key] {
+			warnings.add("%s: %s.conflictElements[%s]: no element named '%s', the conflict is never used", g.configPath, prefix, key, key)
+		}
+
+		for _, name := range strings.Split(conflicts, ",") {
+			if !allElements[name] {
+				warnings.add("%s: %s.conflictElements[%s]: no element named '%s', the conflict is never used", g.configPath, prefix, key, name)
+			}
+		}
+	}
+
+	return problems, warnings
+}
+
+// tint colors are read into the config, the trait name is set if it's empty
+func (g *Generator) validateTint(layer models.LayerOrder, name string) ProblemList {
+
+	var (
+		problems ProblemList
+		tint     = layer.Options.Tint
+
+		field = func(name string, format string, a ...interface{}) {
+			problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+		}
+
+		colorNames  = make(map[string]bool, 0)
+		totalWeight = 0.0
+	)
+
+	if tint.Mode == "" {
+		tint.Mode = utils.TintMultiply
+	}
+
+	if tint.TraitName == "" {
+		tint.TraitName = layer.Options.DisplayName + " color"
+	}
+
+	if tint.Mode != utils.TintMultiply && tint.Mode != utils.TintHue && tint.Mode != utils.TintMap {
+		field(name+".mode", "'%s' should be %s, %s or %s", tint.Mode, utils.TintMultiply, utils.TintHue, utils.TintMap)
+	}
+
+	if len(tint.Colors) == 0 {
+		field(name+".colors", "at least one color is needed")
+	}
+
+	for i, _ := range tint.Colors {
+
+		var (
+			c      = &tint.Colors[i]
+			prefix = fmt.Sprintf("%s.colors[%d]", name, i)
+			hexes  = []string{c.Color}
+		)
+
+		if c.Name == "" {
+			field(prefix+".name", "should not be empty")
+		} else if colorNames[c.Name] {
+			field(prefix+".name", "'%s' is used by another color", c.Name)
+		}
+
+		colorNames[c.Name] = true
+
+		if c.Weight < 0 {
+			field(prefix+".weight", "should not be negative")
+		}
+
+		totalWeight += c.Weight
+
+		if tint.Mode == utils.TintMap {
+			hexes = c.Map
+
+			if len(c.Map) < 2 {
+				field(prefix+".map", "at least 2 colors are needed")
+			}
+		}
+
+		c.ColorList = make([]color.NRGBA, 0)
+
+		for _, hex := range hexes {
+			parsed, err := utils.ParseHexColor(hex)
+
+			if err != nil {
+				field(prefix, "%s", err)
+			}
+
+			c.ColorList = append(c.ColorList, parsed)
+		}
+	}
+
+	// layers following a color set pick the color by name, others pick it by weight
+	if (layer.Options.ColorSet == "" || layer.Options.IsColorBase) && len(tint.Colors) > 0 && totalWeight <= 0 {
+		field(name+".colors", "at least one color should have a weight greater than 0")
+	}
+
+	return problems
+}
+
+// only the header is read, so it's quick even for large images
+func (g *Generator) checkImageFile(path string) error {
+
+	// every frame of a frame folder is checked
+	if isFramesDir(path) {
+		files, err := g.getFrameFiles(path)
+
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if err := g.checkImageFile(f); err != nil {
+				return fmt.Errorf("%s: %s", filepath.Base(f), err)
+			}
+		}
+
+		return nil
+	}
+
+	// svg files need a size to be drawn
+	if isSvgFile(path) {
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		_, _, err = utils.SVGSize(data)
+
+		return err
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, _, err = image.DecodeConfig(file)
+
+	return err
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// conflicts matching no element never stop an element, they are only warned about
+func TestConflictElementWarnings(t *testing.T) {
+
+	var config = newTestConfig(t, `[{
+		"growEditionSizeTo": 5,
+		"layersOrder": `+testLayersOrder+`,
+		"conflictElements": {"cloth1": "necklace1,necklace2", "crown": "laser,monocle"}
+	}]`, `{}`)
+
+	g := newUnvalidatedTestGenerator(t, config, testLayers)
+
+	problems, warnings := g.Validate()
+
+	if len(problems) > 0 {
+		t.Fatalf("config problems:\n%s", problems)
+	}
+
+	for _, name := range []string{"cloth1", "necklace1", "necklace2", "monocle"} {
+		if !strings.Contains(warnings.Error(), "no element named '"+name+"'") {
+			t.Errorf("no warning for '%s':\n%s", name, warnings)
+		}
+	}
+
+	if strings.Contains(warnings.Error(), "'laser'") {
+		t.Errorf("a warning for 'laser' which is an element:\n%s", warnings)
+	}
+
+	// the known conflict still works
+	editions, err := g.Plan(1, make(map[string]bool, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ed := range editions {
+		if hasTestElement(ed, "Hat^crown") && hasTestElement(ed, "Eyes^laser") {
+			t.Errorf("edition %d has a crown and a laser", ed.Id)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// variants
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+
+	"golips_art_engine/models"
+)
+
+// the main images, multiVersionSettings.layerName is left out of them
+func getMainVariant(config *models.Config) models.Variant {
+
+	if config.MultiVersionSettings.LayerName == "" {
+		return models.Variant{}
+	}
+
+	return models.Variant{Exclude: []string{config.MultiVersionSettings.LayerName}}
+}
+
+// multiVersionSettings.layerName is a variant with all the layers, saved to images-<layerName> like before
+func getVariants(config *models.Config) []models.Variant {
+
+	var variants = make([]models.Variant, 0)
+
+	if config.MultiVersionSettings.LayerName != "" {
+		variants = append(variants, models.Variant{Name: config.MultiVersionSettings.LayerName})
+	}
+
+	return append(variants, config.MultiVersionSettings.Variants...)
+}
+
+// a layer is drawn if it's included, or nothing is included, and it's not excluded
+func variantShows(v models.Variant, layerName string) bool {
+
+	if len(v.Include) > 0 && !containsString(v.Include, layerName) {
+		return false
+	}
+
+	return !containsString(v.Exclude, layerName)
+}
+
+// finished images of one of ones are in every variant, only cropped
+func (dna *DNA) shows(v models.Variant, layerName string) bool {
+	return dna.finished || variantShows(v, layerName)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the part of the canvas a variant keeps
+func getVariantRect(v models.Variant, format models.OutputFormat) image.Rectangle {
+
+	if v.Crop == nil {
+		return image.Rect(0, 0, format.Width, format.Height)
+	}
+
+	return image.Rect(v.Crop.X, v.Crop.Y, v.Crop.X+v.Crop.Width, v.Crop.Y+v.Crop.Height)
+}
+
+// cropped images start from 0, 0 like the others
+func cropImage(img image.Image, rect image.Rectangle) image.Image {
+
+	if rect == img.Bounds() {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+
+	return dst
+}
+
+// files of the variants with a base uri, so the metadata can link them
+// k-v: variant name - uri
+func getVariantUris(id int, config *models.Config) map[string]string {
+
+	var uris = make(map[string]string, 0)
+
+	for _, v := range config.MultiVersionSettings.Variants {
+		if v.BaseUri != "" {
+			uris[v.Name] = fmt.Sprintf("%s/%d%s", v.BaseUri, id, getImageFormat(config.Format).ext)
+		}
+	}
+
+	if len(uris) == 0 {
+		return nil
+	}
+
+	return uris
+}
+
+// variants share the images-<name> folders with resolutions, and can only draw the layers and the background
+func (g *Generator) validateVariants(layerNames map[string]bool) ProblemList {
+
+	var (
+		config   = g.config
+		problems ProblemList
+		names    = make(map[string]bool, 0)
+		canvas   = image.Rect(0, 0, config.Format.Width, config.Format.Height)
+	)
+
+	field := func(name string, format string, a ...interface{}) {
+		problems.add("%s: %s: %s", g.configPath, name, fmt.Sprintf(format, a...))
+	}
+
+	if config.MultiVersionSettings.LayerName != "" {
+		names[config.MultiVersionSettings.LayerName] = true
+	}
+
+	for _, r := range config.Format.Resolutions {
+		names[r.Name] = true
+	}
+
+	if config.Format.Raster != "" {
+		names[strings.TrimPrefix(outputRasterDir, outputImagesDir+"-")] = true
+	}
+
+	for i, v := range config.MultiVersionSettings.Variants {
+		prefix := fmt.Sprintf("multiVersionSettings.variants[%d]", i)
+
+		switch {
+		case v.Name == "" || strings.ContainsAny(v.Name, `/\`):
+			field(prefix+".name", "'%s' can not be used as a folder name", v.Name)
+		case names[v.Name]:
+			field(prefix+".name", "'%s' is used by another variant, resolution or multiVersionSettings.layerName, they share the same folder", v.Name)
+		}
+
+		names[v.Name] = true
+
+		for _, list := range []struct {
+			name   string
+			layers []string
+		}{{"include", v.Include}, {"exclude", v.Exclude}} {
+			for _, layer := range list.layers {
+				if !layerNames[layer] && !(config.Background.Generate && layer == config.Background.TraitName) {
+					field(prefix+"."+list.name, "no layer named '%s'", layer)
+				}
+			}
+		}
+
+		if v.Crop != nil && (v.Crop.Width <= 0 || v.Crop.Height <= 0 || !getVariantRect(v, config.Format).In(canvas)) {
+			field(prefix+".crop", "%dx%d at %d, %d should be inside the %dx%d canvas", v.Crop.Width, v.Crop.Height, v.Crop.X, v.Crop.Y, config.Format.Width, config.Format.Height)
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,362 @@
+// generate
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golips_art_engine/engine"
+	"golips_art_engine/models"
+)
+
+func runGenerate(args []string) error {
+
+	fs := newFlagSet("generate")
+
+	seedFlag := fs.String("seed", "", "random seed of this run, overrides the seed in config")
+	force := fs.Bool("force", false, "overwrite the output folder even if it is not empty")
+	processes := fs.String("processes", "", "how many editions are rendered at the same time, a number or 'auto', overrides processCount in config")
+	mode := fs.String("mode", outputModeClean, "what to do with the old output: clean, archive (move it to a timestamped folder) or run (write into a new run folder)")
+
+	fs.Parse(args)
+
+	if *mode != outputModeClean && *mode != outputModeArchive && *mode != outputModeRun {
+		return fmt.Errorf("unknown output mode '%s'", *mode)
+	}
+
+	config, err := readConfig()
+
+	if err != nil {
+		return err
+	}
+
+	if *processes != "" {
+		config.ProcessCount = models.ProcessCount(*processes)
+	}
+
+	// run folders are named before anything is generated, the dna history is still read from the latest one
+	var baseDir = outputDir
+
+	if *mode == outputModeRun {
+		outputDir, err = getNewRunDir(baseDir)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	g := newGenerator(config)
+
+	log.Println("Checking Config...")
+
+	problems, warnings := g.Validate()
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in config:\n%s", len(problems), problems)
+	}
+
+	for _, w := range warnings {
+		log.Println("[Warning]", w)
+	}
+
+	for batch, c := range config.LayerConfigurations {
+		log.Printf("Batch %d: %d editions of %s combinations\n", batch, c.GrowEditionSizeTo, engine.FormatCombinations(c.Combinations))
+	}
+
+	seed, err := getSeed(*seedFlag, config.Seed)
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("Seed: ", seed)
+
+	// load history before cleaning the folder, the default history file lives in builds
+	// 在清理文件夹之前读取历史记录, 默认的历史文件就在builds文件夹中
+	existDNAs := make(map[string]bool, 0)
+
+	if config.DnaSettings.LoadDnaHistory {
+		log.Println("Loading DNA History...")
+
+		historyNames := config.DnaSettings.LoadDnaHistoryName
+
+		if historyNames == "" {
+			historyNames = filepath.Join(baseDir, engine.DnaHistoryFileName)
+
+			if *mode == outputModeRun {
+				historyNames = filepath.Join(getLatestRunDir(baseDir), engine.DnaHistoryFileName)
+			}
+		}
+
+		for _, name := range strings.Split(historyNames, ",") {
+			history, err := g.LoadDnaHistory(strings.TrimSpace(name))
+
+			if err != nil {
+				return err
+			}
+
+			for _, item := range history {
+				existDNAs[item.Dna] = true
+			}
+
+			log.Printf("DNA History Loaded: %d from %s\n", len(history), name)
+		}
+	}
+
+	log.Println("Planning DNA...")
+
+	editions, err := g.Plan(seed, existDNAs)
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("Set Folders...")
+
+	err = prepareOutputDir(*mode, *force)
+
+	if err != nil {
+		return err
+	}
+
+	err = g.CreateOutputFolders()
+
+	if err != nil {
+		return err
+	}
+
+	err = g.SaveBuildInfo(models.BuildInfo{Seed: seed})
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("Begin Generating...")
+
+	// ctrl+c stops the work the same way as a failure
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+
+	defer stop()
+
+	genCount, err := g.RenderEditions(ctx, editions)
+
+	if err != nil {
+		log.Printf("NFT Generated: %d of %d\n", genCount, len(editions))
+
+		return fmt.Errorf("generating failed, rarity and dna history are not saved:\n%s", err)
+	}
+
+	err = g.SaveRarityFiles()
+
+	if err != nil {
+		return err
+	}
+
+	// the same rarity file as the rarity command
+	_, err = g.UpdateRarity()
+
+	if err != nil {
+		return err
+	}
+
+	if config.DnaSettings.SaveDnaHistory {
+		err = g.SaveDnaHistory(editions)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("NFT Generated: %d\nAll Done!\n", genCount)
+
+	return nil
+}
+
+// the flag wins over the config, and a new seed is picked when neither is set
+func getSeed(flagSeed string, configSeed json.Number) (int64, error) {
+
+	if flagSeed != "" {
+		return strconv.ParseInt(flagSeed, 10, 64)
+	}
+
+	if configSeed != "" {
+		return configSeed.Int64()
+	}
+
+	return time.Now().UnixNano(), nil
+}
+
+// never remove a finished build silently
+// 永远不要悄悄删除已经生成好的作品
+func prepareOutputDir(mode string, force bool) error {
+
+	switch mode {
+	case outputModeRun:
+		err := os.MkdirAll(filepath.Dir(outputDir), os.ModePerm)
+
+		if err == nil {
+			err = os.Mkdir(outputDir, os.ModePerm)
+		}
+
+		// another run may take the name after it is picked
+		if os.IsExist(err) {
+			return fmt.Errorf("run folder '%s' is created by another run, please try again", outputDir)
+		}
+
+		if err != nil {
+			if debug {
+				log.Println("[RunFolder]", err)
+			}
+			return err
+		}
+
+		log.Println("Output Folder: ", outputDir)
+
+		return nil
+	case outputModeArchive:
+		if isEmptyDir(outputDir) {
+			return nil
+		}
+
+		if err := checkOutputDirMovable(outputDir); err != nil {
+			return err
+		}
+
+		archiveDir := filepath.Clean(outputDir) + "-archive-" + time.Now().Format(runDirStampLayout)
+
+		err := os.Rename(outputDir, archiveDir)
+
+		if err != nil {
+			if debug {
+				log.Println("[ArchiveFolder]", err)
+			}
+			return err
+		}
+
+		log.Println("Old Build Archived To: ", archiveDir)
+
+		return nil
+	}
+
+	if isEmptyDir(outputDir) {
+		return nil
+	}
+
+	if !force {
+		return fmt.Errorf("output folder '%s' is not empty, use -force to overwrite it, or -mode archive / -mode run to keep it", outputDir)
+	}
+
+	if err := checkOutputDirMovable(outputDir); err != nil {
+		return err
+	}
+
+	err := os.RemoveAll(outputDir)
+
+	if err != nil {
+		if debug {
+			log.Println("[CleanFolder]", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// the output folder is removed by -force and moved by -mode archive, never take the project with it
+// 输出文件夹会被删除或移动, 不能包含当前文件夹、图层文件夹或配置文件
+func checkOutputDirMovable(dir string) error {
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	if containsPath(dir, wd) {
+		return fmt.Errorf("output folder '%s' is the current folder or a parent of it, please use another output folder", dir)
+	}
+
+	for _, path := range []string{inputDir, configPath} {
+		if containsPath(dir, path) {
+			return fmt.Errorf("output folder '%s' contains '%s', please use another output folder", dir, path)
+		}
+	}
+
+	return nil
+}
+
+// whether path is dir or inside it, links are followed when the paths exist
+func containsPath(dir string, path string) bool {
+
+	rel, err := filepath.Rel(getRealPath(dir), getRealPath(path))
+
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func getRealPath(path string) string {
+
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return path
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+
+	return abs
+}
+
+func isEmptyDir(dir string) bool {
+	fileArray, err := ioutil.ReadDir(dir)
+
+	return err != nil || len(fileArray) == 0
+}
+
+// a run folder named by the time which doesn't exist yet, runs in the same second get a number like run-20220101-120000-02
+func getNewRunDir(dir string) (string, error) {
+
+	var (
+		name = runDirPrefix + time.Now().Format(runDirStampLayout)
+		path = filepath.Join(dir, name)
+	)
+
+	for i := 2; i <= 99; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+
+		path = filepath.Join(dir, fmt.Sprintf("%s-%02d", name, i))
+	}
+
+	return "", fmt.Errorf("too many run folders named '%s' in '%s'", name, dir)
+}
+
+// run folders are named by time, so the last one in name order is the latest
+func getLatestRunDir(dir string) string {
+	fileArray, _ := ioutil.ReadDir(dir)
+
+	var latest = ""
+
+	for _, f := range fileArray {
+		if f.IsDir() && strings.HasPrefix(f.Name(), runDirPrefix) && f.Name() > latest {
+			latest = f.Name()
+		}
+	}
+
+	return filepath.Join(dir, latest)
+}
@@ -1,3 +1,5 @@
 module golips_art_engine
 
-go 1.16
+go 1.18
+
+require golang.org/x/image v0.18.0
@@ -0,0 +1,6 @@
+// build_info_formats
+package models
+
+type BuildInfo struct {
+	Seed int64 `json:"seed"`
+}
@@ -3,6 +3,7 @@ package models
 
 import (
 	"encoding/json"
+	"image/color"
 )
 
 type Config struct {
@@ -17,8 +18,10 @@ type Config struct {
 	DnaDelimiter      string           `json:"dnaDelimiter"`
 	DnaSettings       DnaSettings      `json:"dnaSettings"`
 	MetadataSettings  MetadataSettings `json:"metadataSettings"`
-	ProcessCount      json.Number      `json:"processCount"`
+	ProcessCount      ProcessCount     `json:"processCount"`
+	Seed              json.Number      `json:"seed"`
 	LogSettings       LogSettings      `json:"logSettings"`
+	CacheSettings     CacheSettings    `json:"cacheSettings"`
 
 	MultiVersionSettings MultiVersionSettings `json:"multiVersionSettings"`
 
@@ -27,8 +30,49 @@ type Config struct {
 	LayerConfigurations []LayerConfiguration `json:"layerConfigurations"`
 }
 
+// a number, or "auto" to use all the cpus
+type ProcessCount string
+
+func (p *ProcessCount) UnmarshalJSON(data []byte) error {
+	var auto string
+
+	if err := json.Unmarshal(data, &auto); err == nil {
+		*p = ProcessCount(auto)
+		return nil
+	}
+
+	var count json.Number
+
+	if err := json.Unmarshal(data, &count); err != nil {
+		return err
+	}
+
+	*p = ProcessCount(count)
+
+	return nil
+}
+
 type MultiVersionSettings struct {
 	LayerName string `json:"layerName"`
+	// other versions of every edition, each one is saved to its own folder
+	Variants []Variant `json:"variants"`
+}
+
+// a version of the editions with some of the layers, layers are named by their display names
+// and the generated background by background.traitName
+type Variant struct {
+	Name    string    `json:"name"`
+	Include []string  `json:"include"` // layers to draw, empty means all of them
+	Exclude []string  `json:"exclude"` // layers to leave out
+	Crop    *CropRect `json:"crop"`    // part of the canvas to keep, nil means all of it
+	BaseUri string    `json:"baseUri"` // uri of the variant folder, the metadata links the files if it's set
+}
+
+type CropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 type SolanaMetadataSettings struct {
@@ -48,6 +92,7 @@ type DnaSettings struct {
 	LoadDnaHistory     bool   `json:"loadDnaHistory"`
 	LoadDnaHistoryName string `json:"loadDnaHistoryName"`
 	StartId            int    `json:"startId"`
+	ShuffleIds         bool   `json:"shuffleIds"` // give the editions of all batches random ids, picked by the seed
 }
 
 type MetadataSettings struct {
@@ -71,17 +116,56 @@ type NumberAttribute struct {
 	MaxValue int    `json:"maxValue"`
 }
 
+type CacheSettings struct {
+	MemoryLimit int  `json:"memoryLimit"` // MB of decoded layer images to keep, 0 means no limit
+	Preload     bool `json:"preload"`
+}
+
 type LogSettings struct {
 	ShowGeneratingProgress bool `json:"showGeneratingProgress"`
 	Debug                  bool `json:"debug"`
 }
 
 type LayerConfiguration struct {
-	GrowEditionSizeTo int                       `json:"growEditionSizeTo"`
+	GrowEditionSizeTo int                       `json:"growEditionSizeTo"` // editions of the batch, not a running total
+	Count             int                       `json:"count"`             // the same as growEditionSizeTo, only one of them is needed
+	StartId           int                       `json:"startId"`           // id of the first edition, 0 means right after the batch before
 	LayersOrder       []LayerOrder              `json:"layersOrder"`
 	ConflictElements  map[string]string         `json:"conflictElements"`
+	Rules             []TraitRule               `json:"rules"`
+	Quotas            []TraitQuota              `json:"quotas"`
+	OneOfOnes         []OneOfOne                `json:"oneOfOnes"`
 	ColorSets         map[string]string         `json:"-"` // k-v: colorSet-color ie: hair-red
 	Traits            map[string]map[string]int `json:"-"` // k-v: layerName - (elementName-count)
+	Combinations      CombinationCount          `json:"-"`
+}
+
+// a rule between elements of different layers, elements are named like limit folders: 'layer^element'
+type TraitRule struct {
+	Type    string `json:"type"`    // requires, excludes, none or pairs
+	Element string `json:"element"` // the element the rule is about
+	Target  string `json:"target"`  // another element, or the layer which must be none
+}
+
+// how many editions of the layer configuration have the element, elements are named like limit folders: 'layer^element'
+type TraitQuota struct {
+	Element string `json:"element"`
+	Count   int    `json:"count"` // exactly this many editions, 0 means not set
+	Max     int    `json:"max"`   // at most this many editions, 0 means not set
+}
+
+// a hand-crafted edition of the layer configuration, with a finished image or a fixed list of elements
+type OneOfOne struct {
+	Id         int                 `json:"id"`         // edition id like in the file names, within the ids of the batch, 0 means a random one
+	Image      string              `json:"image"`      // finished image, relative to the layers folder
+	Attributes []MetaDataAttribute `json:"attributes"` // attributes of the finished image
+	Elements   []string            `json:"elements"`   // or elements named like dna: 'layer^element' or 'layer^color$element'
+}
+
+// how many distinct dna a layer configuration can create
+type CombinationCount struct {
+	Min float64
+	Max float64
 }
 
 type LayerOrder struct {
@@ -97,6 +181,50 @@ type LayerOption struct {
 	IsColorBase    bool   `json:"isColorBase"`
 	ColorSet       string `json:"colorSet"`
 	HideInMetadata bool   `json:"hideInMetadata"`
+
+	// how the layer mixes with the layers under it, such as multiply, screen, overlay and soft-light
+	BlendMode string `json:"blendMode"`
+	// 0 ~ 1, default is 1
+	Opacity *float64 `json:"opacity"`
+
+	// where the images are put, and the elements which are put somewhere else
+	// k-v: element name - placement
+	Placement
+	Elements map[string]Placement `json:"elements"`
+
+	// tint the greyscale images with a color picked from the palette
+	Tint *LayerTint `json:"tint"`
+}
+
+type LayerTint struct {
+	Mode      string      `json:"mode"`      // multiply, hue or map, default is multiply
+	TraitName string      `json:"traitName"` // default is '<displayName> color'
+	Colors    []TintColor `json:"colors"`
+}
+
+type TintColor struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Color  string  `json:"color"` // multiply and hue mode
+	// map mode: colors from black to white, the lightness of every pixel is mapped to them
+	Map []string `json:"map"`
+
+	ColorList []color.NRGBA `json:"-"`
+}
+
+// the color an element is tinted with
+type ElementTint struct {
+	Mode      string
+	TraitName string
+	Color     TintColor
+}
+
+// where a layer image is put on the canvas, layers without any of these are scaled to the canvas
+type Placement struct {
+	X      *int     `json:"x,omitempty"`
+	Y      *int     `json:"y,omitempty"`
+	Anchor string   `json:"anchor,omitempty"` // such as top-left, center, bottom, default is top-left
+	Scale  *float64 `json:"scale,omitempty"`
 }
 
 type LayerElement struct {
@@ -107,18 +235,71 @@ type LayerElement struct {
 	Weight          float64
 	BelongLayerName string
 	HideInMetadata  bool
+	BlendMode       string
+	Opacity         float64
+	Placement       *Placement   // nil if the image fits the canvas
+	Tint            *ElementTint // nil if the image is not tinted
 }
 
 type OutputFormat struct {
-	Width     int  `json:"width"`
-	Height    int  `json:"height"`
-	Smoothing bool `json:"smoothing"`
+	Width       int                `json:"width"`
+	Height      int                `json:"height"`
+	Smoothing   bool               `json:"smoothing"`
+	Resolutions []OutputResolution `json:"resolutions"`
+	// png, jpeg, webp or svg
+	Type string `json:"type"`
+	// svg only: png, jpeg or webp, the svg documents are also saved as images of this type
+	Raster string `json:"raster"`
+	// png only: default, none, speed or best
+	Compression string `json:"compression"`
+	// jpeg only: 1 ~ 100
+	Quality int `json:"quality"`
+	// editions with animated layers are also saved as animations
+	Animation OutputAnimation `json:"animation"`
+}
+
+type OutputAnimation struct {
+	Type    string `json:"type"`    // gif or apng, empty means only still images are saved
+	Delay   int    `json:"delay"`   // milliseconds of every frame
+	Plays   int    `json:"plays"`   // how many times the animation is played, 0 means forever
+	BaseUri string `json:"baseUri"` // uri of the animations folder, default is baseUri
+}
+
+// the same image saved again at another size, ie: thumbnails
+type OutputResolution struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
 }
 
 type Background struct {
-	Generate      bool    `json:"generate"`
-	Brightness    string  `json:"brightness"`
-	Static        bool    `json:"static"`
-	Default       string  `json:"default"`
-	BrightnessNum float64 `json:"-"`
+	Generate       bool                `json:"generate"`
+	Brightness     string              `json:"brightness"`
+	Static         bool                `json:"static"`
+	Default        string              `json:"default"`
+	ShowInMetadata *bool               `json:"showInMetadata"` // nil means true
+	TraitName      string              `json:"traitName"`
+	Palettes       []BackgroundPalette `json:"palettes"`
+	BrightnessNum  float64             `json:"-"`
+	DefaultColor   color.NRGBA         `json:"-"`
+}
+
+// a named kind of background, picked by weight like layer elements
+type BackgroundPalette struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Type   string  `json:"type"`  // solid, linear or radial, default is solid
+	Angle  float64 `json:"angle"` // direction of a linear gradient in degrees, 0 is left to right
+
+	// solid: one of them is picked, gradients: the stops from start to end.
+	// random hues are used if it's empty
+	Colors []string `json:"colors"`
+
+	// for random hues, how many stops a gradient has, default is 2
+	Stops int `json:"stops"`
+	// for random hues, [min, max] in percent
+	Saturation []float64 `json:"saturation"`
+	Lightness  []float64 `json:"lightness"`
+
+	ColorList []color.NRGBA `json:"-"`
 }
@@ -0,0 +1,8 @@
+// dna_history_formats
+package models
+
+type DnaHistoryItem struct {
+	Dna     string `json:"dna"`
+	Edition int    `json:"edition"`
+	Batch   int    `json:"batch"`
+}
@@ -11,6 +11,8 @@ type MetadataErc721 struct {
 	Name          string              `json:"name"`
 	Description   string              `json:"description,omitempty"`
 	Image         string              `json:"image,omitempty"`
+	AnimationUrl  string              `json:"animation_url,omitempty"`
+	Variants      map[string]string   `json:"variants,omitempty"` // k-v: variant name - uri
 	Dna           string              `json:"dna,omitempty"`
 	Edition       int                 `json:"edition,omitempty"`
 	Date          int64               `json:"date,omitempty"`
@@ -33,7 +35,9 @@ type MetadataSolana struct {
 	SellerFeeBasisPoints json.Number         `json:"seller_fee_basis_points"` // solana
 	Description          string              `json:"description,omitempty"`
 	Image                string              `json:"image,omitempty"`
-	ExternalUrl          string              `json:"external_url"` // solana
+	AnimationUrl         string              `json:"animation_url,omitempty"`
+	Variants             map[string]string   `json:"variants,omitempty"` // k-v: variant name - uri
+	ExternalUrl          string              `json:"external_url"`       // solana
 	Edition              int                 `json:"edition,omitempty"`
 	Dna                  string              `json:"dna,omitempty"`
 	ExtraMetadata        string              `json:"extra!@#,omitempty"`
@@ -0,0 +1,202 @@
+// animation
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// DecodeFrames decodes every frame of an animated gif or apng, the frames are composed to the full size of the animation.
+// other images return only one frame
+// 解码gif或apng动图的每一帧, 每一帧都是合成后的完整画面
+func DecodeFrames(r io.Reader) ([]image.Image, error) {
+
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("GIF8")) {
+		return decodeGifFrames(data)
+	}
+
+	if bytes.HasPrefix(data, []byte(pngSignature)) && isAnimatedPng(data) {
+		return decodeApngFrames(data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []image.Image{img}, nil
+}
+
+func decodeGifFrames(data []byte) ([]image.Image, error) {
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+
+	var (
+		canvas = image.NewNRGBA(bounds)
+		frames = make([]image.Image, 0, len(g.Image))
+	)
+
+	for i, img := range g.Image {
+
+		var disposal byte
+
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		frames = append(frames, cloneNRGBA(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, nil
+}
+
+// EncodeGIF writes the frames as an animated gif with one palette for all the frames,
+// delay is in milliseconds and plays is how many times the animation is played, 0 means forever
+func EncodeGIF(w io.Writer, frames []image.Image, delay int, plays int) error {
+
+	palette, transparent := Quantize(frames, 256)
+
+	var (
+		bounds = frames[0].Bounds()
+		g      = &gif.GIF{
+			Config: image.Config{ColorModel: palette, Width: bounds.Dx(), Height: bounds.Dy()},
+		}
+		// k-v: color - index in the palette
+		indexes = make(map[color.NRGBA]uint8, 0)
+	)
+
+	switch {
+	case plays == 0:
+		g.LoopCount = 0
+	case plays == 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = plays - 1
+	}
+
+	for _, frame := range frames {
+		var (
+			nrgba = toNRGBA(frame)
+			img   = image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+		)
+
+		for i := 0; i < len(img.Pix); i++ {
+			p := nrgba.Pix[i*4 : i*4+4]
+
+			if transparent && p[3] < 128 {
+				img.Pix[i] = uint8(len(palette) - 1)
+				continue
+			}
+
+			c := color.NRGBA{p[0], p[1], p[2], 0xff}
+
+			index, exist := indexes[c]
+
+			if !exist {
+				index = uint8(nearestColor(palette, c, transparent))
+				indexes[c] = index
+			}
+
+			img.Pix[i] = index
+		}
+
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, (delay+5)/10)
+
+		// transparent pixels would show the last frame without clearing it
+		if transparent {
+			g.Disposal = append(g.Disposal, gif.DisposalBackground)
+		} else {
+			g.Disposal = append(g.Disposal, gif.DisposalNone)
+		}
+	}
+
+	return gif.EncodeAll(w, g)
+}
+
+func nearestColor(palette color.Palette, c color.NRGBA, transparent bool) int {
+
+	var (
+		count    = len(palette)
+		best     = 0
+		bestDist = -1
+	)
+
+	// the last one is the transparent color
+	if transparent {
+		count--
+	}
+
+	for i := 0; i < count; i++ {
+		p := palette[i].(color.NRGBA)
+
+		dr := int(p.R) - int(c.R)
+		dg := int(p.G) - int(c.G)
+		db := int(p.B) - int(c.B)
+
+		dist := dr*dr + dg*dg + db*db
+
+		if bestDist < 0 || dist < bestDist {
+			best = i
+			bestDist = dist
+		}
+	}
+
+	return best
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if m, ok := img.(*image.NRGBA); ok && m.Rect.Min == image.ZP && m.Stride == m.Rect.Dx()*4 {
+		return m
+	}
+
+	b := img.Bounds()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	return dst
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	dst := image.NewNRGBA(img.Bounds())
+	copy(dst.Pix, img.Pix)
+
+	return dst
+}
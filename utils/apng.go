@@ -0,0 +1,420 @@
+// apng
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// apng is png with extra chunks for frames, see https://wiki.mozilla.org/APNG_Specification
+// image/png only reads the first frame, so the frames are decoded one by one as small png files
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+
+	apngBlendSource = 0
+	apngBlendOver   = 1
+)
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+type apngFrame struct {
+	rect    image.Rectangle
+	dispose byte
+	blend   byte
+	data    []byte
+}
+
+func readPngChunks(data []byte) ([]pngChunk, error) {
+
+	chunks := make([]pngChunk, 0)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("png: truncated chunk")
+		}
+
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+
+		if length < 0 || i+12+length > len(data) {
+			return nil, errors.New("png: truncated chunk")
+		}
+
+		chunks = append(chunks, pngChunk{kind: string(data[i+4 : i+8]), data: data[i+8 : i+8+length]})
+
+		i += 12 + length
+	}
+
+	return chunks, nil
+}
+
+// the animation control chunk comes before the image data
+func isAnimatedPng(data []byte) bool {
+
+	chunks, err := readPngChunks(data)
+
+	if err != nil {
+		return false
+	}
+
+	for _, c := range chunks {
+		switch c.kind {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+
+	return false
+}
+
+func decodeApngFrames(data []byte) ([]image.Image, error) {
+
+	chunks, err := readPngChunks(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		header []byte
+		// chunks every frame needs, such as the palette
+		shared  = make([]pngChunk, 0)
+		list    = make([]*apngFrame, 0)
+		current *apngFrame
+	)
+
+	for _, c := range chunks {
+		switch c.kind {
+		case "IHDR":
+			header = c.data
+		case "PLTE", "tRNS":
+			shared = append(shared, c)
+		case "fcTL":
+			if len(c.data) < 26 {
+				return nil, errors.New("apng: wrong fcTL chunk")
+			}
+
+			var (
+				width  = int(binary.BigEndian.Uint32(c.data[4:8]))
+				height = int(binary.BigEndian.Uint32(c.data[8:12]))
+				x      = int(binary.BigEndian.Uint32(c.data[12:16]))
+				y      = int(binary.BigEndian.Uint32(c.data[16:20]))
+			)
+
+			current = &apngFrame{
+				rect:    image.Rect(x, y, x+width, y+height),
+				dispose: c.data[24],
+				blend:   c.data[25],
+			}
+
+			list = append(list, current)
+		case "IDAT":
+			// the default image is not a frame without a fcTL chunk before it
+			if current != nil {
+				current.data = append(current.data, c.data...)
+			}
+		case "fdAT":
+			if current != nil && len(c.data) >= 4 {
+				current.data = append(current.data, c.data[4:]...)
+			}
+		}
+	}
+
+	if len(header) < 13 || len(list) == 0 {
+		return nil, errors.New("apng: no frame found")
+	}
+
+	var (
+		canvas = image.NewNRGBA(image.Rect(0, 0, int(binary.BigEndian.Uint32(header[0:4])), int(binary.BigEndian.Uint32(header[4:8]))))
+		frames = make([]image.Image, 0, len(list))
+	)
+
+	for i, f := range list {
+
+		var buf bytes.Buffer
+
+		buf.WriteString(pngSignature)
+
+		frameHeader := append([]byte{}, header...)
+		binary.BigEndian.PutUint32(frameHeader[0:4], uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(frameHeader[4:8], uint32(f.rect.Dy()))
+
+		writePngChunk(&buf, "IHDR", frameHeader)
+
+		for _, c := range shared {
+			writePngChunk(&buf, c.kind, c.data)
+		}
+
+		writePngChunk(&buf, "IDAT", f.data)
+		writePngChunk(&buf, "IEND", nil)
+
+		img, err := png.Decode(&buf)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dispose := f.dispose
+
+		// the first frame has nothing to go back to
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+
+		var previous *image.NRGBA
+
+		if dispose == apngDisposePrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		if f.blend == apngBlendOver {
+			draw.Draw(canvas, f.rect, img, img.Bounds().Min, draw.Over)
+		} else {
+			draw.Draw(canvas, f.rect, img, img.Bounds().Min, draw.Src)
+		}
+
+		frames = append(frames, cloneNRGBA(canvas))
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, f.rect, image.Transparent, image.ZP, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+
+	return frames, nil
+}
+
+func writePngChunk(w io.Writer, kind string, data []byte) error {
+
+	var header [8]byte
+
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	copy(header[4:8], kind)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:8])
+	crc.Write(data)
+
+	var sum [4]byte
+
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+
+	for _, b := range [][]byte{header[:], data, sum[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EncodeAPNG writes the frames as an animated png, every frame is drawn over the whole canvas.
+// delay is in milliseconds and plays is how many times the animation is played, 0 means forever
+func EncodeAPNG(w io.Writer, frames []image.Image, delay int, plays int) error {
+
+	var (
+		bounds = frames[0].Bounds()
+		width  = bounds.Dx()
+		height = bounds.Dy()
+		list   = make([]*image.NRGBA, 0, len(frames))
+		opaque = true
+	)
+
+	for _, f := range frames {
+		img := toNRGBA(f)
+
+		if !img.Opaque() {
+			opaque = false
+		}
+
+		list = append(list, img)
+	}
+
+	// rgb without alpha when every frame is opaque
+	var (
+		colorType byte = 6
+		channels       = 4
+	)
+
+	if opaque {
+		colorType = 2
+		channels = 3
+	}
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(height))
+	header[8] = 8
+	header[9] = colorType
+
+	control := make([]byte, 8)
+	binary.BigEndian.PutUint32(control[0:4], uint32(len(list)))
+	binary.BigEndian.PutUint32(control[4:8], uint32(plays))
+
+	if err := writePngChunk(w, "IHDR", header); err != nil {
+		return err
+	}
+
+	if err := writePngChunk(w, "acTL", control); err != nil {
+		return err
+	}
+
+	var sequence uint32
+
+	for i, img := range list {
+
+		frameControl := make([]byte, 26)
+		binary.BigEndian.PutUint32(frameControl[0:4], sequence)
+		binary.BigEndian.PutUint32(frameControl[4:8], uint32(width))
+		binary.BigEndian.PutUint32(frameControl[8:12], uint32(height))
+		binary.BigEndian.PutUint16(frameControl[20:22], uint16(delay))
+		binary.BigEndian.PutUint16(frameControl[22:24], 1000)
+		frameControl[24] = apngDisposeNone
+		frameControl[25] = apngBlendSource
+
+		sequence++
+
+		if err := writePngChunk(w, "fcTL", frameControl); err != nil {
+			return err
+		}
+
+		data, err := compressPngRows(img, channels)
+
+		if err != nil {
+			return err
+		}
+
+		// the first frame is the default image, which is shown by viewers without apng support
+		if i == 0 {
+			err = writePngChunk(w, "IDAT", data)
+		} else {
+			frameData := make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(frameData, sequence)
+			sequence++
+
+			err = writePngChunk(w, "fdAT", append(frameData, data...))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return writePngChunk(w, "IEND", nil)
+}
+
+// every row uses the filter with the smallest sum, like image/png does
+func compressPngRows(img *image.NRGBA, channels int) ([]byte, error) {
+
+	var (
+		buf    bytes.Buffer
+		width  = img.Rect.Dx()
+		size   = width * channels
+		prev   = make([]byte, size)
+		row    = make([]byte, size)
+		filter = make([]byte, size+1)
+		best   = make([]byte, size+1)
+	)
+
+	zw := zlib.NewWriter(&buf)
+
+	for y := 0; y < img.Rect.Dy(); y++ {
+		pix := img.Pix[y*img.Stride : y*img.Stride+width*4]
+
+		for x := 0; x < width; x++ {
+			copy(row[x*channels:x*channels+channels], pix[x*4:x*4+channels])
+		}
+
+		bestSum := -1
+
+		for f := byte(0); f < 5; f++ {
+			filter[0] = f
+			sum := 0
+
+			for i := 0; i < size; i++ {
+				var a, b, c int
+
+				if i >= channels {
+					a = int(row[i-channels])
+					c = int(prev[i-channels])
+				}
+
+				b = int(prev[i])
+
+				var predicted int
+
+				switch f {
+				case 1:
+					predicted = a
+				case 2:
+					predicted = b
+				case 3:
+					predicted = (a + b) / 2
+				case 4:
+					predicted = paeth(a, b, c)
+				}
+
+				v := row[i] - byte(predicted)
+				filter[i+1] = v
+				sum += abs(int(int8(v)))
+			}
+
+			if bestSum < 0 || sum < bestSum {
+				bestSum = sum
+				copy(best, filter)
+			}
+		}
+
+		if _, err := zw.Write(best); err != nil {
+			return nil, err
+		}
+
+		prev, row = row, prev
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func paeth(a, b, c int) int {
+	p := a + b - c
+
+	pa := abs(p - a)
+	pb := abs(p - b)
+	pc := abs(p - c)
+
+	if pa <= pb && pa <= pc {
+		return a
+	}
+
+	if pb <= pc {
+		return b
+	}
+
+	return c
+}
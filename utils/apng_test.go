@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func newTestFrames(opaque bool) []image.Image {
+
+	var frames = make([]image.Image, 0)
+
+	for i := 0; i < 3; i++ {
+		img := newTestImage(23, 17, int64(i))
+
+		if opaque {
+			for j := 3; j < len(img.Pix); j += 4 {
+				img.Pix[j] = 255
+			}
+		}
+
+		frames = append(frames, img)
+	}
+
+	return frames
+}
+
+func TestEncodeAPNGChunks(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	if err := EncodeAPNG(&buf, newTestFrames(false), 120, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		data     = buf.Bytes()
+		fcTL     = 0
+		sequence = uint32(0)
+	)
+
+	if string(data[:len(pngSignature)]) != pngSignature {
+		t.Fatal("no png signature")
+	}
+
+	// crc of every chunk is checked here, readPngChunks doesn't
+	for i := len(pngSignature); i < len(data); {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		kind := string(data[i+4 : i+8])
+		sum := binary.BigEndian.Uint32(data[i+8+length : i+12+length])
+
+		if want := crc32.ChecksumIEEE(data[i+4 : i+8+length]); sum != want {
+			t.Errorf("%s: crc %08x, want %08x", kind, sum, want)
+		}
+
+		body := data[i+8 : i+8+length]
+
+		switch kind {
+		case "acTL":
+			if frames, plays := binary.BigEndian.Uint32(body[0:4]), binary.BigEndian.Uint32(body[4:8]); frames != 3 || plays != 2 {
+				t.Errorf("acTL: %d frames %d plays, want 3 frames 2 plays", frames, plays)
+			}
+		case "fcTL", "fdAT":
+			if n := binary.BigEndian.Uint32(body[0:4]); n != sequence {
+				t.Errorf("%s: sequence %d, want %d", kind, n, sequence)
+			}
+
+			sequence++
+
+			if kind == "fcTL" {
+				fcTL++
+
+				if num, den := binary.BigEndian.Uint16(body[20:22]), binary.BigEndian.Uint16(body[22:24]); num != 120 || den != 1000 {
+					t.Errorf("fcTL: delay %d/%d, want 120/1000", num, den)
+				}
+			}
+		}
+
+		i += 12 + length
+	}
+
+	if fcTL != 3 {
+		t.Errorf("%d fcTL chunks, want 3", fcTL)
+	}
+
+	if !isAnimatedPng(data) {
+		t.Error("not found as animated")
+	}
+}
+
+func TestEncodeAPNGRoundTrip(t *testing.T) {
+
+	for _, opaque := range []bool{false, true} {
+		var (
+			want = newTestFrames(opaque)
+			buf  bytes.Buffer
+		)
+
+		if err := EncodeAPNG(&buf, want, 100, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		// image/png reads the first frame as the default image
+		first, err := png.Decode(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSamePixels(t, "first frame", toNRGBA(want[0]), first)
+
+		got, err := decodeApngFrames(buf.Bytes())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("%d frames, want %d", len(got), len(want))
+		}
+
+		for i := range want {
+			assertSamePixels(t, "frame", toNRGBA(want[i]), got[i])
+		}
+	}
+}
+
+func TestIsAnimatedPng(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	if isAnimatedPng(buf.Bytes()) {
+		t.Error("a still png is found as animated")
+	}
+}
+
+func TestQuantize(t *testing.T) {
+
+	var img = image.NewNRGBA(image.Rect(0, 0, 4, 4))
+
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+
+	for i := 0; i < 16; i++ {
+		img.SetNRGBA(i%4, i/4, colors[i%3])
+	}
+
+	palette, transparent := Quantize([]image.Image{img}, 256)
+
+	if transparent || len(palette) != 3 {
+		t.Fatalf("%d colors, transparent %v, want 3 colors without transparent", len(palette), transparent)
+	}
+
+	// fewer colors than max are kept as they are
+	for _, c := range colors {
+		if palette[palette.Index(c)] != c {
+			t.Errorf("%v is not in the palette", c)
+		}
+	}
+
+	img.SetNRGBA(0, 0, color.NRGBA{})
+
+	palette, transparent = Quantize([]image.Image{img, newTestImage(40, 40, 1)}, 16)
+
+	if !transparent || len(palette) != 16 {
+		t.Fatalf("%d colors, transparent %v, want 16 colors with transparent", len(palette), transparent)
+	}
+
+	if _, _, _, a := palette[len(palette)-1].RGBA(); a != 0 {
+		t.Error("the last color is not transparent")
+	}
+
+	again, _ := Quantize([]image.Image{img, newTestImage(40, 40, 1)}, 16)
+
+	for i := range palette {
+		if palette[i] != again[i] {
+			t.Fatal("the same images get another palette")
+		}
+	}
+}
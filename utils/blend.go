@@ -0,0 +1,183 @@
+// blend
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// blend modes, named the same as css and the canvas of browsers
+const (
+	BlendNormal     = "normal"
+	BlendMultiply   = "multiply"
+	BlendScreen     = "screen"
+	BlendOverlay    = "overlay"
+	BlendDarken     = "darken"
+	BlendLighten    = "lighten"
+	BlendColorDodge = "color-dodge"
+	BlendColorBurn  = "color-burn"
+	BlendHardLight  = "hard-light"
+	BlendSoftLight  = "soft-light"
+	BlendDifference = "difference"
+	BlendExclusion  = "exclusion"
+)
+
+// mix a source channel with a backdrop channel, both are 0 ~ 1 and not premultiplied
+type blendFunc func(cb, cs float64) float64
+
+var blendFuncs = map[string]blendFunc{
+	BlendMultiply: func(cb, cs float64) float64 {
+		return cb * cs
+	},
+	BlendScreen: screen,
+	BlendOverlay: func(cb, cs float64) float64 {
+		return hardLight(cs, cb)
+	},
+	BlendDarken:  math.Min,
+	BlendLighten: math.Max,
+	BlendColorDodge: func(cb, cs float64) float64 {
+		switch {
+		case cb == 0:
+			return 0
+		case cs >= 1:
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	},
+	BlendColorBurn: func(cb, cs float64) float64 {
+		switch {
+		case cb >= 1:
+			return 1
+		case cs <= 0:
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	},
+	BlendHardLight: func(cb, cs float64) float64 {
+		return hardLight(cb, cs)
+	},
+	BlendSoftLight: func(cb, cs float64) float64 {
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+
+		var d float64
+
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		} else {
+			d = math.Sqrt(cb)
+		}
+
+		return cb + (2*cs-1)*(d-cb)
+	},
+	BlendDifference: func(cb, cs float64) float64 {
+		return math.Abs(cb - cs)
+	},
+	BlendExclusion: func(cb, cs float64) float64 {
+		return cb + cs - 2*cb*cs
+	},
+}
+
+func screen(cb, cs float64) float64 {
+	return cb + cs - cb*cs
+}
+
+func hardLight(cb, cs float64) float64 {
+	if cs <= 0.5 {
+		return cb * 2 * cs
+	}
+
+	return screen(cb, 2*cs-1)
+}
+
+// IsBlendMode tells if the mode can be used by DrawBlend, empty means normal
+func IsBlendMode(mode string) bool {
+	if mode == "" || mode == BlendNormal {
+		return true
+	}
+
+	_, exist := blendFuncs[mode]
+
+	return exist
+}
+
+// DrawBlend draws src over dst like draw.Draw with draw.Over, but mixes the colors with the blend mode
+// and makes src transparent by the opacity (0 ~ 1). the formulas come from the W3C compositing spec
+// 与draw.Draw的draw.Over相同, 但是会按混合模式混合颜色, 并按不透明度(0 ~ 1)绘制
+func DrawBlend(dst *image.RGBA, r image.Rectangle, src image.Image, sp image.Point, mode string, opacity float64) {
+
+	if opacity <= 0 {
+		return
+	}
+
+	fn, exist := blendFuncs[mode]
+
+	// the normal mode is left to the draw package, which is much faster
+	if !exist {
+		if opacity >= 1 {
+			draw.Draw(dst, r, src, sp, draw.Over)
+		} else {
+			draw.DrawMask(dst, r, src, sp, image.NewUniform(color.Alpha{uint8(opacity*255 + 0.5)}), image.ZP, draw.Over)
+		}
+
+		return
+	}
+
+	// clip the rectangle the same way as draw.Draw
+	var (
+		dx = sp.X - r.Min.X
+		dy = sp.Y - r.Min.Y
+	)
+
+	r = r.Intersect(dst.Bounds()).Intersect(src.Bounds().Add(r.Min.Sub(sp)))
+
+	if r.Empty() {
+		return
+	}
+
+	opacity = math.Min(opacity, 1)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sr16, sg16, sb16, sa16 := src.At(x+dx, y+dy).RGBA()
+
+			if sa16 == 0 {
+				continue
+			}
+
+			i := dst.PixOffset(x, y)
+
+			var (
+				as = float64(sa16) / 0xffff * opacity
+				ab = float64(dst.Pix[i+3]) / 0xff
+			)
+
+			// source colors are premultiplied by the alpha, which is before the opacity
+			srcColor := [3]float64{float64(sr16) / float64(sa16), float64(sg16) / float64(sa16), float64(sb16) / float64(sa16)}
+
+			for c := 0; c < 3; c++ {
+				var (
+					// premultiplied backdrop
+					pb = float64(dst.Pix[i+c]) / 0xff
+					cb = 0.0
+					cs = srcColor[c]
+				)
+
+				if ab > 0 {
+					cb = pb / ab
+				}
+
+				mixed := (1-ab)*cs + ab*fn(cb, cs)
+
+				co := as*mixed + (1-as)*pb
+
+				dst.Pix[i+c] = uint8(math.Max(0, math.Min(1, co))*0xff + 0.5)
+			}
+
+			dst.Pix[i+3] = uint8(math.Min(1, as+ab*(1-as))*0xff + 0.5)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// color
+package utils
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// ParseHexColor reads colors like #RGB, #RGBA, #RRGGBB and #RRGGBBAA
+func ParseHexColor(hex string) (color.NRGBA, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+
+	// short forms repeat every digit, #f80 is #ff8800
+	if len(s) == 3 || len(s) == 4 {
+		var long strings.Builder
+
+		for _, c := range s {
+			long.WriteRune(c)
+			long.WriteRune(c)
+		}
+
+		s = long.String()
+	}
+
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	if len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("'%s' is not a hex color like #RRGGBB or #RRGGBBAA", hex)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("'%s' is not a hex color like #RRGGBB or #RRGGBBAA", hex)
+	}
+
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// FormatHexColor writes #RRGGBB, or #RRGGBBAA when the color is not opaque
+func FormatHexColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
@@ -0,0 +1,60 @@
+// file
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// temp files of this process are numbered, so they never collide
+var tempFileCount uint64
+
+// WriteFileAtomic writes into a temp file first and renames it at last,
+// so a failed or canceled write never leaves a truncated file behind
+func WriteFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := createTempFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	err = write(tmp)
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// the temp file is created like os.Create, with mode 0666 before umask, and rename keeps the mode.
+// ioutil.TempFile would make every output 0600
+func createTempFile(path string) (*os.File, error) {
+
+	var dir, base = filepath.Dir(path), filepath.Base(path)
+
+	for {
+		name := filepath.Join(dir, fmt.Sprintf(".%s.%d-%d.tmp", base, os.Getpid(), atomic.AddUint64(&tempFileCount, 1)))
+
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+
+		// left by another run with the same pid
+		if os.IsExist(err) {
+			continue
+		}
+
+		return f, err
+	}
+}
@@ -9,7 +9,7 @@ func HSLToRGB(h, s, l float64) color.RGBA {
 
 	if s == 0 {
 		// it's gray
-		return color.RGBA{uint8(l), uint8(l), uint8(l), 255}
+		return color.RGBA{uint8(l * 255), uint8(l * 255), uint8(l * 255), 255}
 	}
 
 	var v1, v2 float64
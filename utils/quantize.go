@@ -0,0 +1,174 @@
+// quantize
+package utils
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+type colorCount struct {
+	c     [3]uint8
+	count int
+}
+
+type colorBox struct {
+	colors []colorCount
+	total  int
+}
+
+// Quantize picks at most max colors for the images with median cut.
+// when there are transparent pixels, the last color of the palette is transparent and true is returned
+// 使用中位切分法为图片选出最多max种颜色, 有透明像素时调色板的最后一个颜色为透明色
+func Quantize(images []image.Image, max int) (color.Palette, bool) {
+
+	var (
+		counts      = make(map[[3]uint8]int, 0)
+		transparent = false
+	)
+
+	for _, img := range images {
+		nrgba := toNRGBA(img)
+
+		for i := 0; i < len(nrgba.Pix); i += 4 {
+			p := nrgba.Pix[i : i+4]
+
+			if p[3] < 128 {
+				transparent = true
+				continue
+			}
+
+			counts[[3]uint8{p[0], p[1], p[2]}]++
+		}
+	}
+
+	if transparent {
+		max--
+	}
+
+	colors := make([]colorCount, 0, len(counts))
+
+	for c, n := range counts {
+		colors = append(colors, colorCount{c, n})
+	}
+
+	// map order is random, sort so the same images always get the same palette
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return uint32(a[0])<<16|uint32(a[1])<<8|uint32(a[2]) < uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2])
+	})
+
+	var boxes = make([]*colorBox, 0)
+
+	if len(colors) > 0 {
+		boxes = append(boxes, newColorBox(colors))
+	}
+
+	for len(boxes) < max {
+		// split the box with the most pixels which has more than one color
+		var target = -1
+
+		for i, b := range boxes {
+			if len(b.colors) > 1 && (target < 0 || b.total > boxes[target].total) {
+				target = i
+			}
+		}
+
+		if target < 0 {
+			break
+		}
+
+		left, right := boxes[target].split()
+
+		boxes[target] = left
+		boxes = append(boxes, right)
+	}
+
+	palette := make(color.Palette, 0, len(boxes)+1)
+
+	for _, b := range boxes {
+		palette = append(palette, b.average())
+	}
+
+	if transparent || len(palette) == 0 {
+		palette = append(palette, color.NRGBA{})
+	}
+
+	return palette, transparent
+}
+
+func newColorBox(colors []colorCount) *colorBox {
+	b := &colorBox{colors: colors}
+
+	for _, c := range colors {
+		b.total += c.count
+	}
+
+	return b
+}
+
+// split at the median pixel of the channel with the widest range
+func (b *colorBox) split() (*colorBox, *colorBox) {
+
+	var (
+		channel  = 0
+		maxRange = -1
+	)
+
+	for ch := 0; ch < 3; ch++ {
+		var low, high uint8 = 255, 0
+
+		for _, c := range b.colors {
+			if c.c[ch] < low {
+				low = c.c[ch]
+			}
+
+			if c.c[ch] > high {
+				high = c.c[ch]
+			}
+		}
+
+		if int(high)-int(low) > maxRange {
+			channel = ch
+			maxRange = int(high) - int(low)
+		}
+	}
+
+	sort.SliceStable(b.colors, func(i, j int) bool {
+		return b.colors[i].c[channel] < b.colors[j].c[channel]
+	})
+
+	var (
+		half  = 0
+		index = len(b.colors) - 1
+	)
+
+	for i, c := range b.colors[:len(b.colors)-1] {
+		half += c.count
+
+		if half*2 >= b.total {
+			index = i + 1
+			break
+		}
+	}
+
+	return newColorBox(b.colors[:index]), newColorBox(b.colors[index:])
+}
+
+// the color of the box is weighted by pixel counts
+func (b *colorBox) average() color.NRGBA {
+	var sum [3]int
+
+	for _, c := range b.colors {
+		for ch := 0; ch < 3; ch++ {
+			sum[ch] += int(c.c[ch]) * c.count
+		}
+	}
+
+	return color.NRGBA{
+		uint8((sum[0] + b.total/2) / b.total),
+		uint8((sum[1] + b.total/2) / b.total),
+		uint8((sum[2] + b.total/2) / b.total),
+		0xff,
+	}
+}
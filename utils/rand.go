@@ -0,0 +1,14 @@
+// rand
+package utils
+
+// EditionSeed mixes the run seed with the edition number (splitmix64),
+// so every edition gets its own independent random source.
+func EditionSeed(seed int64, edition int) int64 {
+	z := uint64(seed) + uint64(edition)*0x9E3779B97F4A7C15
+
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z = z ^ (z >> 31)
+
+	return int64(z)
+}
@@ -0,0 +1,659 @@
+// raster
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// a small scanline rasterizer for the svg renderer: paths are flattened to polygons in pixels,
+// strokes are turned into polygons too, then everything is filled with anti-aliasing
+
+const (
+	// sub scanlines of every pixel row, the horizontal coverage is exact
+	rasterSubSamples = 8
+
+	// length in pixels of the lines a curve is split into
+	curveSegmentLength = 2
+
+	// how many lines a round join or cap uses
+	roundSegments = 16
+
+	defaultMiterLimit = 4
+)
+
+type point struct {
+	x, y float64
+}
+
+func (p point) add(q point) point {
+	return point{p.x + q.x, p.y + q.y}
+}
+
+func (p point) sub(q point) point {
+	return point{p.x - q.x, p.y - q.y}
+}
+
+func (p point) scale(s float64) point {
+	return point{p.x * s, p.y * s}
+}
+
+func (p point) length() float64 {
+	return math.Hypot(p.x, p.y)
+}
+
+// x' = a*x + c*y + e, y' = b*x + d*y + f
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// the result applies n first, then m
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m matrix) apply(p point) point {
+	return point{m[0]*p.x + m[2]*p.y + m[4], m[1]*p.x + m[3]*p.y + m[5]}
+}
+
+func (m matrix) invert() matrix {
+	det := m[0]*m[3] - m[1]*m[2]
+
+	if det == 0 {
+		return identityMatrix
+	}
+
+	return matrix{
+		m[3] / det,
+		-m[1] / det,
+		-m[2] / det,
+		m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det,
+		(m[1]*m[4] - m[0]*m[5]) / det,
+	}
+}
+
+// how much the matrix scales lengths, used for stroke widths
+func (m matrix) scaleFactor() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+func translateMatrix(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+func scaleMatrix(x, y float64) matrix {
+	return matrix{x, 0, 0, y, 0, 0}
+}
+
+// pathBuilder takes points in user space and keeps the flattened lines in pixels
+type pathBuilder struct {
+	m        matrix
+	subpaths [][]point
+	closed   []bool
+
+	// bounding box in user space, gradients of the shape are relative to it
+	min, max point
+	empty    bool
+
+	// current point and the start of the subpath in user space
+	last, start point
+}
+
+func newPathBuilder(m matrix) *pathBuilder {
+	return &pathBuilder{m: m, empty: true}
+}
+
+func (b *pathBuilder) extend(p point) {
+	if b.empty {
+		b.min, b.max, b.empty = p, p, false
+		return
+	}
+
+	b.min = point{math.Min(b.min.x, p.x), math.Min(b.min.y, p.y)}
+	b.max = point{math.Max(b.max.x, p.x), math.Max(b.max.y, p.y)}
+}
+
+func (b *pathBuilder) moveTo(p point) {
+	b.subpaths = append(b.subpaths, []point{b.m.apply(p)})
+	b.closed = append(b.closed, false)
+	b.last = p
+	b.start = p
+	b.extend(p)
+}
+
+func (b *pathBuilder) lineTo(p point) {
+	if len(b.subpaths) == 0 {
+		b.moveTo(b.last)
+	}
+
+	i := len(b.subpaths) - 1
+
+	b.subpaths[i] = append(b.subpaths[i], b.m.apply(p))
+	b.last = p
+	b.extend(p)
+}
+
+func (b *pathBuilder) cubicTo(c1, c2, p point) {
+
+	var (
+		p0 = b.m.apply(b.last)
+		d1 = b.m.apply(c1)
+		d2 = b.m.apply(c2)
+		d3 = b.m.apply(p)
+		n  = curveSegments(p0.sub(d1).length() + d1.sub(d2).length() + d2.sub(d3).length())
+	)
+
+	b.extend(c1)
+	b.extend(c2)
+
+	if len(b.subpaths) == 0 {
+		b.moveTo(b.last)
+	}
+
+	i := len(b.subpaths) - 1
+
+	for k := 1; k <= n; k++ {
+		t := float64(k) / float64(n)
+		u := 1 - t
+
+		b.subpaths[i] = append(b.subpaths[i], point{
+			u*u*u*p0.x + 3*u*u*t*d1.x + 3*u*t*t*d2.x + t*t*t*d3.x,
+			u*u*u*p0.y + 3*u*u*t*d1.y + 3*u*t*t*d2.y + t*t*t*d3.y,
+		})
+	}
+
+	b.last = p
+	b.extend(p)
+}
+
+func (b *pathBuilder) quadTo(c, p point) {
+	// a quadratic curve is a cubic one with control points at 2/3
+	b.cubicTo(b.last.add(c.sub(b.last).scale(2.0/3)), p.add(c.sub(p).scale(2.0/3)), p)
+}
+
+// arcTo follows the endpoint parameterization of svg, see https://www.w3.org/TR/SVG11/implnote.html#ArcImplementationNotes
+func (b *pathBuilder) arcTo(rx, ry, rotation float64, large, sweep bool, p point) {
+
+	var from = b.last
+
+	rx, ry = math.Abs(rx), math.Abs(ry)
+
+	if rx == 0 || ry == 0 || from == p {
+		b.lineTo(p)
+		return
+	}
+
+	var (
+		phi    = rotation * math.Pi / 180
+		cosPhi = math.Cos(phi)
+		sinPhi = math.Sin(phi)
+		dx     = (from.x - p.x) / 2
+		dy     = (from.y - p.y) / 2
+		x1     = cosPhi*dx + sinPhi*dy
+		y1     = -sinPhi*dx + cosPhi*dy
+	)
+
+	// radii that are too small are scaled up
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx *= math.Sqrt(l)
+		ry *= math.Sqrt(l)
+	}
+
+	var (
+		num  = rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+		den  = rx*rx*y1*y1 + ry*ry*x1*x1
+		coef = math.Sqrt(math.Max(0, num/den))
+	)
+
+	if large == sweep {
+		coef = -coef
+	}
+
+	var (
+		cx1 = coef * rx * y1 / ry
+		cy1 = -coef * ry * x1 / rx
+		cx  = cosPhi*cx1 - sinPhi*cy1 + (from.x+p.x)/2
+		cy  = sinPhi*cx1 + cosPhi*cy1 + (from.y+p.y)/2
+
+		angle = func(ux, uy, vx, vy float64) float64 {
+			return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+		}
+
+		start = angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+		delta = angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	)
+
+	if delta == 0 {
+		b.lineTo(p)
+		return
+	}
+
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	// every part is at most 90 degrees, so the cubic curves stay close to the ellipse
+	var (
+		parts = int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+		step  = delta / float64(parts)
+		kappa = 4.0 / 3 * math.Tan(step/4)
+
+		onEllipse = func(a float64) (point, point) {
+			cos, sin := math.Cos(a), math.Sin(a)
+
+			return point{cx + rx*cos*cosPhi - ry*sin*sinPhi, cy + rx*cos*sinPhi + ry*sin*cosPhi},
+				point{-rx*sin*cosPhi - ry*cos*sinPhi, -rx*sin*sinPhi + ry*cos*cosPhi}
+		}
+	)
+
+	for i := 0; i < parts; i++ {
+		var (
+			a1      = start + step*float64(i)
+			a2      = a1 + step
+			p1, t1  = onEllipse(a1)
+			p2, t2  = onEllipse(a2)
+			control = t1.scale(kappa)
+		)
+
+		if i == parts-1 {
+			p2 = p
+		}
+
+		b.cubicTo(p1.add(control), p2.sub(t2.scale(kappa)), p2)
+	}
+}
+
+func (b *pathBuilder) close() {
+	if len(b.closed) == 0 {
+		return
+	}
+
+	i := len(b.subpaths) - 1
+
+	b.closed[i] = true
+
+	// a new subpath after close starts from the first point
+	b.last = b.start
+}
+
+func curveSegments(length float64) int {
+	n := int(math.Ceil(length / curveSegmentLength))
+
+	if n < 1 {
+		return 1
+	}
+
+	if n > 256 {
+		return 256
+	}
+
+	return n
+}
+
+type edge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+// paint gives the color of a pixel
+type paint func(x, y int) color.NRGBA
+
+func uniformPaint(c color.NRGBA) paint {
+	return func(x, y int) color.NRGBA {
+		return c
+	}
+}
+
+// fillPolygons draws the polygons with anti-aliasing, evenOdd picks the fill rule instead of nonzero
+func fillPolygons(dst *image.RGBA, polygons [][]point, p paint, opacity float64, evenOdd bool) {
+
+	var (
+		edges  = make([]edge, 0)
+		bounds = dst.Bounds()
+		top    = math.Inf(1)
+		bottom = math.Inf(-1)
+	)
+
+	for _, poly := range polygons {
+		for i := range poly {
+			a, b := poly[i], poly[(i+1)%len(poly)]
+
+			if a.y == b.y {
+				continue
+			}
+
+			e := edge{a.x, a.y, b.x, b.y, 1}
+
+			if a.y > b.y {
+				e = edge{b.x, b.y, a.x, a.y, -1}
+			}
+
+			edges = append(edges, e)
+
+			top = math.Min(top, e.y0)
+			bottom = math.Max(bottom, e.y1)
+		}
+	}
+
+	if len(edges) == 0 {
+		return
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].y0 < edges[j].y0
+	})
+
+	var (
+		minY     = int(math.Max(math.Floor(top), float64(bounds.Min.Y)))
+		maxY     = int(math.Min(math.Ceil(bottom), float64(bounds.Max.Y)))
+		width    = bounds.Dx()
+		coverage = make([]float64, width+1)
+		active   = make([]edge, 0)
+		next     = 0
+
+		crossing = make([]struct {
+			x   float64
+			dir int
+		}, 0)
+	)
+
+	for y := minY; y < maxY; y++ {
+
+		for i := range coverage {
+			coverage[i] = 0
+		}
+
+		for s := 0; s < rasterSubSamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/rasterSubSamples
+
+			for next < len(edges) && edges[next].y0 <= sy {
+				active = append(active, edges[next])
+				next++
+			}
+
+			crossing = crossing[:0]
+
+			kept := active[:0]
+
+			for _, e := range active {
+				if e.y1 <= sy {
+					continue
+				}
+
+				kept = append(kept, e)
+
+				if e.y0 <= sy {
+					crossing = append(crossing, struct {
+						x   float64
+						dir int
+					}{e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.dir})
+				}
+			}
+
+			active = kept
+
+			sort.Slice(crossing, func(i, j int) bool {
+				return crossing[i].x < crossing[j].x
+			})
+
+			winding := 0
+
+			for i := 0; i+1 < len(crossing); i++ {
+				winding += crossing[i].dir
+
+				inside := winding != 0
+
+				if evenOdd {
+					inside = winding%2 != 0
+				}
+
+				if inside {
+					addSpan(coverage, crossing[i].x-float64(bounds.Min.X), crossing[i+1].x-float64(bounds.Min.X), 1.0/rasterSubSamples)
+				}
+			}
+		}
+
+		for x := 0; x < width; x++ {
+			if coverage[x] <= 0 {
+				continue
+			}
+
+			c := p(bounds.Min.X+x, y)
+
+			blendPixel(dst, bounds.Min.X+x, y, c, math.Min(coverage[x], 1)*opacity*float64(c.A)/255)
+		}
+	}
+}
+
+// add the covered part of every pixel between x0 and x1
+func addSpan(coverage []float64, x0, x1 float64, weight float64) {
+
+	var width = float64(len(coverage) - 1)
+
+	x0 = math.Max(0, math.Min(width, x0))
+	x1 = math.Max(0, math.Min(width, x1))
+
+	if x1 <= x0 {
+		return
+	}
+
+	var (
+		first = int(x0)
+		last  = int(x1)
+	)
+
+	if first == last {
+		coverage[first] += (x1 - x0) * weight
+		return
+	}
+
+	coverage[first] += (float64(first+1) - x0) * weight
+
+	for x := first + 1; x < last; x++ {
+		coverage[x] += weight
+	}
+
+	coverage[last] += (x1 - float64(last)) * weight
+}
+
+// source over with a non-premultiplied color
+func blendPixel(dst *image.RGBA, x, y int, c color.NRGBA, alpha float64) {
+
+	if alpha <= 0 {
+		return
+	}
+
+	var (
+		i    = dst.PixOffset(x, y)
+		pix  = dst.Pix[i : i+4]
+		rest = 1 - alpha
+	)
+
+	pix[0] = uint8(float64(c.R)*alpha + float64(pix[0])*rest + 0.5)
+	pix[1] = uint8(float64(c.G)*alpha + float64(pix[1])*rest + 0.5)
+	pix[2] = uint8(float64(c.B)*alpha + float64(pix[2])*rest + 0.5)
+	pix[3] = uint8(255*alpha + float64(pix[3])*rest + 0.5)
+}
+
+type strokeStyle struct {
+	width      float64
+	cap        string
+	join       string
+	miterLimit float64
+}
+
+// strokePolygons turns the lines into polygons, they all turn the same way so nonzero filling joins them
+func strokePolygons(subpaths [][]point, closed []bool, style strokeStyle) [][]point {
+
+	var (
+		polygons = make([][]point, 0)
+		half     = style.width / 2
+	)
+
+	add := func(poly []point) {
+		if polygonArea(poly) < 0 {
+			for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+				poly[i], poly[j] = poly[j], poly[i]
+			}
+		}
+
+		polygons = append(polygons, poly)
+	}
+
+	for k, path := range subpaths {
+
+		// drop repeated points
+		points := make([]point, 0, len(path))
+
+		for _, p := range path {
+			if len(points) == 0 || p.sub(points[len(points)-1]).length() > 1e-9 {
+				points = append(points, p)
+			}
+		}
+
+		if closed[k] && len(points) > 1 && points[0].sub(points[len(points)-1]).length() > 1e-9 {
+			points = append(points, points[0])
+		}
+
+		if len(points) < 2 {
+			// a dot with round or square caps is still drawn
+			if len(points) == 1 && style.cap == "round" {
+				add(circlePolygon(points[0], half))
+			} else if len(points) == 1 && style.cap == "square" {
+				p := points[0]
+				add([]point{{p.x - half, p.y - half}, {p.x + half, p.y - half}, {p.x + half, p.y + half}, {p.x - half, p.y + half}})
+			}
+
+			continue
+		}
+
+		if !closed[k] && style.cap == "square" {
+			first := points[1].sub(points[0])
+			points[0] = points[0].sub(first.scale(half / first.length()))
+
+			n := len(points)
+			last := points[n-1].sub(points[n-2])
+			points[n-1] = points[n-1].add(last.scale(half / last.length()))
+		}
+
+		for i := 0; i+1 < len(points); i++ {
+			a, b := points[i], points[i+1]
+			d := b.sub(a)
+			n := point{-d.y, d.x}.scale(half / d.length())
+
+			add([]point{a.add(n), b.add(n), b.sub(n), a.sub(n)})
+		}
+
+		// joins between the lines, and between the last and the first one of closed paths
+		for i := 1; i < len(points); i++ {
+			if i == len(points)-1 && !closed[k] {
+				break
+			}
+
+			var (
+				v    = points[i]
+				prev = points[i-1]
+				next point
+			)
+
+			if i == len(points)-1 {
+				next = points[1]
+			} else {
+				next = points[i+1]
+			}
+
+			addJoin(add, prev, v, next, half, style)
+		}
+
+		if !closed[k] && style.cap == "round" {
+			add(circlePolygon(points[0], half))
+			add(circlePolygon(points[len(points)-1], half))
+		}
+	}
+
+	return polygons
+}
+
+func addJoin(add func([]point), prev, v, next point, half float64, style strokeStyle) {
+
+	if style.join == "round" {
+		add(circlePolygon(v, half))
+		return
+	}
+
+	var (
+		d1 = v.sub(prev)
+		d2 = next.sub(v)
+		n1 = point{-d1.y, d1.x}.scale(half / d1.length())
+		n2 = point{-d2.y, d2.x}.scale(half / d2.length())
+	)
+
+	// the outer side of the turn
+	if d1.x*d2.y-d1.y*d2.x > 0 {
+		n1 = n1.scale(-1)
+		n2 = n2.scale(-1)
+	}
+
+	var bevel = []point{v, v.add(n1), v.add(n2)}
+
+	if style.join == "bevel" {
+		add(bevel)
+		return
+	}
+
+	// the miter point is where the outer lines meet
+	var (
+		cos   = (d1.x*d2.x + d1.y*d2.y) / (d1.length() * d2.length())
+		theta = math.Acos(math.Max(-1, math.Min(1, cos)))
+		limit = style.miterLimit
+	)
+
+	if limit <= 0 {
+		limit = defaultMiterLimit
+	}
+
+	// 1 / sin(half of the angle between the lines) is the miter ratio
+	if math.Cos(theta/2) <= 1e-9 || 1/math.Cos(theta/2) > limit {
+		add(bevel)
+		return
+	}
+
+	bisector := n1.add(n2)
+	miter := v.add(bisector.scale(half / math.Cos(theta/2) / bisector.length()))
+
+	add([]point{v, v.add(n1), miter, v.add(n2)})
+}
+
+func circlePolygon(c point, r float64) []point {
+	poly := make([]point, roundSegments)
+
+	for i := range poly {
+		a := 2 * math.Pi * float64(i) / roundSegments
+		poly[i] = point{c.x + r*math.Cos(a), c.y + r*math.Sin(a)}
+	}
+
+	return poly
+}
+
+func polygonArea(poly []point) float64 {
+	var area float64
+
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		area += a.x*b.y - b.x*a.y
+	}
+
+	return area / 2
+}
@@ -0,0 +1,58 @@
+// resize
+package utils
+
+import (
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Resize scales the image, smooth chooses a high quality filter instead of the nearest pixel
+func Resize(src image.Image, width int, height int, smooth bool) *image.RGBA {
+	if smooth {
+		return ResizeSmooth(src, width, height)
+	}
+
+	return ResizeNearest(src, width, height)
+}
+
+// ResizeNearest scales the image with the nearest pixel, which keeps the edges sharp
+func ResizeNearest(src image.Image, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	b := src.Bounds()
+
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		sy := b.Min.Y + y*b.Dy()/height
+
+		for x := 0; x < width; x++ {
+			sx := b.Min.X + x*b.Dx()/width
+
+			dst.Set(x, y, color.RGBAModel.Convert(src.At(sx, sy)))
+		}
+	}
+
+	return dst
+}
+
+// ResizeSmooth scales the image with the Catmull-Rom filter of x/image, the filter gets wider when shrinking
+// so every source pixel counts. colors are premultiplied, transparent pixels won't darken the edges
+// 使用Catmull-Rom滤波缩放图片, 缩小时滤波范围随之变大, 所有源像素都会参与计算
+func ResizeSmooth(src image.Image, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	b := src.Bounds()
+
+	if b.Dx() == 0 || b.Dy() == 0 || width <= 0 || height <= 0 {
+		return dst
+	}
+
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	return dst
+}
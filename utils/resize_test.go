@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newFilledImage(width, height int, c color.RGBA) *image.RGBA {
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+
+	return img
+}
+
+func TestResizeNearest(t *testing.T) {
+
+	var src = image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	src.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	src.SetRGBA(1, 1, color.RGBA{0, 0, 255, 255})
+
+	dst := ResizeNearest(src, 4, 4)
+
+	// every source pixel becomes a 2x2 block with the same color
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if got, want := dst.RGBAAt(x, y), src.RGBAAt(x/2, y/2); got != want {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestResizeSmooth(t *testing.T) {
+
+	var red = color.RGBA{200, 30, 60, 255}
+
+	// a flat color stays the same, up and down
+	for _, size := range [][2]int{{37, 23}, {5, 3}, {1, 1}} {
+		dst := ResizeSmooth(newFilledImage(16, 16, red), size[0], size[1])
+
+		if dst.Bounds().Dx() != size[0] || dst.Bounds().Dy() != size[1] {
+			t.Fatalf("size %v, want %v", dst.Bounds().Size(), size)
+		}
+
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				if got := dst.RGBAAt(x, y); got != red {
+					t.Fatalf("%dx%d: pixel (%d, %d) is %v, want %v", size[0], size[1], x, y, got, red)
+				}
+			}
+		}
+	}
+
+	// half of the pixels are transparent black, shrinking to 1 pixel keeps the color at half alpha
+	var src = newFilledImage(8, 8, red)
+
+	for y := 0; y < 8; y++ {
+		for x := 4; x < 8; x++ {
+			src.SetRGBA(x, y, color.RGBA{})
+		}
+	}
+
+	got := ResizeSmooth(src, 1, 1).RGBAAt(0, 0)
+
+	if got.A < 126 || got.A > 129 {
+		t.Fatalf("alpha %d, want about 128", got.A)
+	}
+
+	// premultiplied colors are never brighter than the alpha, and the edge isn't darkened
+	if nrgba := color.NRGBAModel.Convert(got).(color.NRGBA); absDiff(nrgba.R, red.R) > 2 || absDiff(nrgba.G, red.G) > 2 || absDiff(nrgba.B, red.B) > 2 {
+		t.Errorf("color %v, want %v at half alpha", nrgba, red)
+	}
+
+	if empty := ResizeSmooth(image.NewRGBA(image.Rect(0, 0, 0, 0)), 4, 4); empty.Bounds().Dx() != 4 {
+		t.Errorf("size %v of an empty image, want 4x4", empty.Bounds().Size())
+	}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
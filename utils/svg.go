@@ -0,0 +1,1388 @@
+// svg
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RasterizeSVG draws svg files without any other tools, it covers what layer art usually needs:
+// paths and basic shapes, groups, nested svg, use, transforms, fill and stroke with colors or gradients,
+// opacity and mix-blend-mode. text, filters, masks, clip paths, patterns and images are not drawn.
+// 不依赖其他工具绘制svg, 支持路径与基础图形、分组、嵌套svg、use、变换、纯色与渐变的填充和描边、透明度与混合模式.
+// 不支持文字、滤镜、遮罩、裁剪路径、图案与图片
+
+type svgNode struct {
+	name     string
+	attrs    map[string]string
+	children []*svgNode
+}
+
+type svgStyle struct {
+	fill          string
+	stroke        string
+	fillOpacity   float64
+	strokeOpacity float64
+	strokeWidth   string
+	fillRule      string
+	lineCap       string
+	lineJoin      string
+	miterLimit    float64
+	color         string
+}
+
+var defaultSvgStyle = svgStyle{
+	fill:          "black",
+	stroke:        "none",
+	fillOpacity:   1,
+	strokeOpacity: 1,
+	strokeWidth:   "1",
+	fillRule:      "nonzero",
+	lineCap:       "butt",
+	lineJoin:      "miter",
+	miterLimit:    defaultMiterLimit,
+	color:         "black",
+}
+
+// elements which are never drawn by themselves
+var svgHiddenElements = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "symbol": true, "linearGradient": true, "radialGradient": true,
+	"pattern": true, "title": true, "desc": true, "metadata": true, "style": true, "script": true, "filter": true,
+	"marker": true, "text": true, "image": true, "foreignObject": true,
+}
+
+var svgNamedColors = map[string]color.NRGBA{
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"yellow":      {255, 255, 0, 255},
+	"cyan":        {0, 255, 255, 255},
+	"aqua":        {0, 255, 255, 255},
+	"magenta":     {255, 0, 255, 255},
+	"fuchsia":     {255, 0, 255, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"silver":      {192, 192, 192, 255},
+	"maroon":      {128, 0, 0, 255},
+	"olive":       {128, 128, 0, 255},
+	"navy":        {0, 0, 128, 255},
+	"purple":      {128, 0, 128, 255},
+	"teal":        {0, 128, 128, 255},
+	"orange":      {255, 165, 0, 255},
+	"pink":        {255, 192, 203, 255},
+	"brown":       {165, 42, 42, 255},
+	"gold":        {255, 215, 0, 255},
+	"transparent": {0, 0, 0, 0},
+}
+
+var (
+	svgTransformRegexp = regexp.MustCompile(`(\w+)\s*\(([^)]*)\)`)
+	svgNumberRegexp    = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+)
+
+func parseSVG(data []byte) (*svgNode, error) {
+
+	var (
+		decoder = xml.NewDecoder(bytes.NewReader(data))
+		stack   = make([]*svgNode, 0)
+		root    *svgNode
+	)
+
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &svgNode{name: t.Name.Local, attrs: make(map[string]string, 0)}
+
+			for _, a := range t.Attr {
+				node.attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+			}
+
+			// style overrides the attributes
+			for _, part := range strings.Split(node.attrs["style"], ";") {
+				kv := strings.SplitN(part, ":", 2)
+
+				if len(kv) == 2 {
+					node.attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+				}
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if root == nil || root.name != "svg" {
+		return nil, errors.New("svg: no svg element found")
+	}
+
+	return root, nil
+}
+
+// SVGSize reads the size of the svg from width and height, or from the viewBox
+func SVGSize(data []byte) (float64, float64, error) {
+
+	root, err := parseSVG(data)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return getSvgSize(root)
+}
+
+func getSvgSize(root *svgNode) (float64, float64, error) {
+
+	var (
+		width, okW  = parseSvgNumber(root.attrs["width"])
+		height, okH = parseSvgNumber(root.attrs["height"])
+	)
+
+	if okW && okH && !strings.HasSuffix(root.attrs["width"], "%") && !strings.HasSuffix(root.attrs["height"], "%") && width > 0 && height > 0 {
+		return width, height, nil
+	}
+
+	if box, ok := parseViewBox(root.attrs["viewBox"]); ok {
+		return box[2], box[3], nil
+	}
+
+	return 0, 0, errors.New("svg: width and height or viewBox should be set")
+}
+
+// RasterizeSVG draws the svg to an image of the size, the svg is fitted by its viewBox
+func RasterizeSVG(data []byte, width, height int) (*image.RGBA, error) {
+
+	root, err := parseSVG(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &svgRenderer{ids: make(map[string]*svgNode, 0)}
+
+	r.index(root)
+
+	// without a viewBox the size of the svg is used as one, so it's scaled to the image too
+	if _, ok := parseViewBox(root.attrs["viewBox"]); !ok {
+		if w, h, err := getSvgSize(root); err == nil {
+			root.attrs["viewBox"] = fmt.Sprintf("0 0 %g %g", w, h)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	viewport := r.viewportMatrix(root, 0, 0, float64(width), float64(height))
+
+	r.renderChildren(dst, root, viewport, defaultSvgStyle.inherit(root), r.viewportSize(root, float64(width), float64(height)))
+
+	return dst, nil
+}
+
+type svgRenderer struct {
+	// k-v: id - element, for gradients and use
+	ids map[string]*svgNode
+	// stops use from going around in circles
+	depth int
+}
+
+func (r *svgRenderer) index(n *svgNode) {
+	if id := n.attrs["id"]; id != "" {
+		if _, exist := r.ids[id]; !exist {
+			r.ids[id] = n
+		}
+	}
+
+	for _, c := range n.children {
+		r.index(c)
+	}
+}
+
+// the matrix from the viewBox of an svg element to its viewport
+func (r *svgRenderer) viewportMatrix(n *svgNode, x, y, width, height float64) matrix {
+
+	box, ok := parseViewBox(n.attrs["viewBox"])
+
+	if !ok || box[2] <= 0 || box[3] <= 0 {
+		return translateMatrix(x, y)
+	}
+
+	var (
+		sx     = width / box[2]
+		sy     = height / box[3]
+		aspect = strings.Fields(n.attrs["preserveAspectRatio"])
+		align  = "xMidYMid"
+		slice  = false
+	)
+
+	if len(aspect) > 0 {
+		align = aspect[0]
+	}
+
+	if len(aspect) > 1 {
+		slice = aspect[1] == "slice"
+	}
+
+	if align == "none" {
+		return translateMatrix(x, y).mul(scaleMatrix(sx, sy)).mul(translateMatrix(-box[0], -box[1]))
+	}
+
+	s := math.Min(sx, sy)
+
+	if slice {
+		s = math.Max(sx, sy)
+	}
+
+	var (
+		dx = width - box[2]*s
+		dy = height - box[3]*s
+	)
+
+	switch {
+	case strings.HasPrefix(align, "xMin"):
+		dx = 0
+	case strings.HasPrefix(align, "xMid"):
+		dx /= 2
+	}
+
+	switch {
+	case strings.HasSuffix(align, "YMin"):
+		dy = 0
+	case strings.HasSuffix(align, "YMid"):
+		dy /= 2
+	}
+
+	return translateMatrix(x+dx, y+dy).mul(scaleMatrix(s, s)).mul(translateMatrix(-box[0], -box[1]))
+}
+
+// percentages inside an svg element are relative to its viewBox
+func (r *svgRenderer) viewportSize(n *svgNode, width, height float64) point {
+	if box, ok := parseViewBox(n.attrs["viewBox"]); ok {
+		return point{box[2], box[3]}
+	}
+
+	return point{width, height}
+}
+
+func (r *svgRenderer) renderChildren(dst *image.RGBA, n *svgNode, m matrix, style svgStyle, viewport point) {
+	for _, c := range n.children {
+		r.render(dst, c, m, style, viewport)
+	}
+}
+
+// elements with opacity or a blend mode are drawn on their own layer first, then mixed into dst
+func (r *svgRenderer) render(dst *image.RGBA, n *svgNode, m matrix, parent svgStyle, viewport point) {
+
+	if svgHiddenElements[n.name] || n.attrs["display"] == "none" || r.depth > 32 {
+		return
+	}
+
+	var (
+		opacity = parseSvgOpacity(n.attrs["opacity"])
+		blend   = n.attrs["mix-blend-mode"]
+	)
+
+	if opacity >= 1 && (blend == "" || blend == BlendNormal || !IsBlendMode(blend)) {
+		r.renderNode(dst, n, m, parent, viewport)
+		return
+	}
+
+	if opacity <= 0 {
+		return
+	}
+
+	layer := image.NewRGBA(dst.Bounds())
+
+	r.renderNode(layer, n, m, parent, viewport)
+
+	DrawBlend(dst, dst.Bounds(), layer, dst.Bounds().Min, blend, opacity)
+}
+
+func (r *svgRenderer) renderNode(dst *image.RGBA, n *svgNode, m matrix, parent svgStyle, viewport point) {
+
+	var style = parent.inherit(n)
+
+	if t, ok := n.attrs["transform"]; ok {
+		m = m.mul(parseSvgTransform(t))
+	}
+
+	r.depth++
+	defer func() { r.depth-- }()
+
+	switch n.name {
+	case "svg":
+		var (
+			x      = parseSvgLength(n.attrs["x"], viewport.x, 0)
+			y      = parseSvgLength(n.attrs["y"], viewport.y, 0)
+			width  = parseSvgLength(n.attrs["width"], viewport.x, viewport.x)
+			height = parseSvgLength(n.attrs["height"], viewport.y, viewport.y)
+		)
+
+		if dst = clipViewport(dst, n, m, x, y, width, height); dst == nil {
+			return
+		}
+
+		r.renderChildren(dst, n, m.mul(r.viewportMatrix(n, x, y, width, height)), style, r.viewportSize(n, width, height))
+	case "g", "a", "switch":
+		r.renderChildren(dst, n, m, style, viewport)
+	case "use":
+		ref := r.ids[strings.TrimPrefix(n.attrs["href"], "#")]
+
+		if ref == nil {
+			return
+		}
+
+		var (
+			x = parseSvgLength(n.attrs["x"], viewport.x, 0)
+			y = parseSvgLength(n.attrs["y"], viewport.y, 0)
+		)
+
+		m = m.mul(translateMatrix(x, y))
+
+		// a symbol works like a nested svg
+		if ref.name == "symbol" {
+			var (
+				width  = parseSvgLength(n.attrs["width"], viewport.x, viewport.x)
+				height = parseSvgLength(n.attrs["height"], viewport.y, viewport.y)
+			)
+
+			if dst = clipViewport(dst, ref, m, 0, 0, width, height); dst == nil {
+				return
+			}
+
+			r.renderChildren(dst, ref, m.mul(r.viewportMatrix(ref, 0, 0, width, height)), style.inherit(ref), r.viewportSize(ref, width, height))
+			return
+		}
+
+		r.render(dst, ref, m, style, viewport)
+	default:
+		b := newPathBuilder(m)
+
+		if !buildSvgShape(b, n, viewport) {
+			return
+		}
+
+		r.drawShape(dst, b, style, m, viewport)
+	}
+}
+
+// nested svg elements hide what is out of them like browsers do, nil if nothing can be seen.
+// rotated or skewed ones are not clipped
+func clipViewport(dst *image.RGBA, n *svgNode, m matrix, x, y, width, height float64) *image.RGBA {
+
+	if overflow := n.attrs["overflow"]; overflow == "visible" || overflow == "auto" || m[1] != 0 || m[2] != 0 {
+		return dst
+	}
+
+	var (
+		from = m.apply(point{x, y})
+		to   = m.apply(point{x + width, y + height})
+		rect = image.Rect(int(math.Round(from.x)), int(math.Round(from.y)), int(math.Round(to.x)), int(math.Round(to.y))).Intersect(dst.Bounds())
+	)
+
+	if rect.Empty() {
+		return nil
+	}
+
+	return dst.SubImage(rect).(*image.RGBA)
+}
+
+func (r *svgRenderer) drawShape(dst *image.RGBA, b *pathBuilder, style svgStyle, m matrix, viewport point) {
+
+	if len(b.subpaths) == 0 {
+		return
+	}
+
+	if fill, ok := r.getPaint(style.fill, style, b, m, viewport); ok {
+		fillPolygons(dst, b.subpaths, fill, style.fillOpacity, style.fillRule == "evenodd")
+	}
+
+	stroke, ok := r.getPaint(style.stroke, style, b, m, viewport)
+
+	if !ok {
+		return
+	}
+
+	width := parseSvgLength(style.strokeWidth, math.Hypot(viewport.x, viewport.y)/math.Sqrt2, 1) * m.scaleFactor()
+
+	if width <= 0 {
+		return
+	}
+
+	polygons := strokePolygons(b.subpaths, b.closed, strokeStyle{width: width, cap: style.lineCap, join: style.lineJoin, miterLimit: style.miterLimit})
+
+	fillPolygons(dst, polygons, stroke, style.strokeOpacity, false)
+}
+
+// a color or a gradient, false means nothing is drawn
+func (r *svgRenderer) getPaint(value string, style svgStyle, b *pathBuilder, m matrix, viewport point) (paint, bool) {
+
+	if value == "" || value == "none" {
+		return nil, false
+	}
+
+	if strings.HasPrefix(value, "url(") {
+		var (
+			end      = strings.Index(value, ")")
+			id       = strings.Trim(strings.TrimSpace(value[4:maxInt(end, 4)]), `#"'`)
+			fallback = strings.TrimSpace(value[maxInt(end+1, 0):])
+		)
+
+		if g := r.ids[id]; g != nil && end > 0 {
+			if p, ok := r.getGradient(g, b, m, viewport); ok {
+				return p, true
+			}
+		}
+
+		if fallback == "" {
+			return nil, false
+		}
+
+		value = fallback
+	}
+
+	if value == "currentColor" {
+		value = style.color
+	}
+
+	c, ok := parseSvgColor(value)
+
+	if !ok || c.A == 0 {
+		return nil, false
+	}
+
+	return uniformPaint(c), true
+}
+
+type gradientStop struct {
+	offset float64
+	color  color.NRGBA
+}
+
+func (r *svgRenderer) getGradient(g *svgNode, b *pathBuilder, m matrix, viewport point) (paint, bool) {
+
+	if g.name != "linearGradient" && g.name != "radialGradient" {
+		return nil, false
+	}
+
+	// stops and attributes can come from the gradient it links to
+	var (
+		chain = []*svgNode{g}
+		attr  = func(name string) string {
+			for _, n := range chain {
+				if v, ok := n.attrs[name]; ok {
+					return v
+				}
+			}
+
+			return ""
+		}
+	)
+
+	for ref := r.ids[strings.TrimPrefix(g.attrs["href"], "#")]; ref != nil && len(chain) < 8; ref = r.ids[strings.TrimPrefix(ref.attrs["href"], "#")] {
+		chain = append(chain, ref)
+	}
+
+	var stops = make([]gradientStop, 0)
+
+	for _, n := range chain {
+		for _, c := range n.children {
+			if c.name != "stop" {
+				continue
+			}
+
+			col, ok := parseSvgColor(c.attrs["stop-color"])
+
+			if !ok {
+				col = color.NRGBA{0, 0, 0, 255}
+			}
+
+			col.A = uint8(float64(col.A)*parseSvgOpacity(c.attrs["stop-opacity"]) + 0.5)
+
+			offset := parseSvgLength(c.attrs["offset"], 1, 0)
+
+			// offsets never go back
+			if len(stops) > 0 && offset < stops[len(stops)-1].offset {
+				offset = stops[len(stops)-1].offset
+			}
+
+			stops = append(stops, gradientStop{math.Max(0, math.Min(1, offset)), col})
+		}
+
+		if len(stops) > 0 {
+			break
+		}
+	}
+
+	if len(stops) == 0 {
+		return nil, false
+	}
+
+	if len(stops) == 1 {
+		return uniformPaint(stops[0].color), true
+	}
+
+	var (
+		userSpace = attr("gradientUnits") == "userSpaceOnUse"
+		space     = m
+		refX      = 1.0
+		refY      = 1.0
+	)
+
+	if userSpace {
+		refX, refY = viewport.x, viewport.y
+	} else {
+		size := b.max.sub(b.min)
+
+		if size.x <= 0 || size.y <= 0 {
+			return nil, false
+		}
+
+		space = space.mul(translateMatrix(b.min.x, b.min.y)).mul(scaleMatrix(size.x, size.y))
+	}
+
+	if t := attr("gradientTransform"); t != "" {
+		space = space.mul(parseSvgTransform(t))
+	}
+
+	var (
+		inverse = space.invert()
+		length  = func(name string, ref float64, def float64) float64 {
+			return parseSvgLength(attr(name), ref, def)
+		}
+		position func(p point) float64
+	)
+
+	if g.name == "linearGradient" {
+		var (
+			x1 = length("x1", refX, 0)
+			y1 = length("y1", refY, 0)
+			x2 = length("x2", refX, refX)
+			y2 = length("y2", refY, 0)
+			dx = x2 - x1
+			dy = y2 - y1
+			d2 = dx*dx + dy*dy
+		)
+
+		if d2 == 0 {
+			return uniformPaint(stops[len(stops)-1].color), true
+		}
+
+		position = func(p point) float64 {
+			return ((p.x-x1)*dx + (p.y-y1)*dy) / d2
+		}
+	} else {
+		var (
+			cx     = length("cx", refX, refX/2)
+			cy     = length("cy", refY, refY/2)
+			radius = length("r", math.Hypot(refX, refY)/math.Sqrt2, math.Hypot(refX, refY)/math.Sqrt2/2)
+		)
+
+		if radius <= 0 {
+			return uniformPaint(stops[len(stops)-1].color), true
+		}
+
+		position = func(p point) float64 {
+			return math.Hypot(p.x-cx, p.y-cy) / radius
+		}
+	}
+
+	return func(x, y int) color.NRGBA {
+		return getStopColor(stops, position(inverse.apply(point{float64(x) + 0.5, float64(y) + 0.5})))
+	}, true
+}
+
+func getStopColor(stops []gradientStop, t float64) color.NRGBA {
+
+	if t <= stops[0].offset {
+		return stops[0].color
+	}
+
+	i := sort.Search(len(stops), func(i int) bool {
+		return stops[i].offset >= t
+	})
+
+	if i >= len(stops) {
+		return stops[len(stops)-1].color
+	}
+
+	var (
+		from = stops[i-1]
+		to   = stops[i]
+		frac = 0.0
+	)
+
+	if to.offset > from.offset {
+		frac = (t - from.offset) / (to.offset - from.offset)
+	}
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*frac + 0.5)
+	}
+
+	return color.NRGBA{lerp(from.color.R, to.color.R), lerp(from.color.G, to.color.G), lerp(from.color.B, to.color.B), lerp(from.color.A, to.color.A)}
+}
+
+// the style of an element, based on the one of its parent
+func (s svgStyle) inherit(n *svgNode) svgStyle {
+
+	if v, ok := n.attrs["fill"]; ok && v != "inherit" {
+		s.fill = v
+	}
+
+	if v, ok := n.attrs["stroke"]; ok && v != "inherit" {
+		s.stroke = v
+	}
+
+	if v, ok := n.attrs["fill-opacity"]; ok {
+		s.fillOpacity = parseSvgOpacity(v)
+	}
+
+	if v, ok := n.attrs["stroke-opacity"]; ok {
+		s.strokeOpacity = parseSvgOpacity(v)
+	}
+
+	if v, ok := n.attrs["stroke-width"]; ok {
+		s.strokeWidth = v
+	}
+
+	if v, ok := n.attrs["fill-rule"]; ok {
+		s.fillRule = v
+	}
+
+	if v, ok := n.attrs["stroke-linecap"]; ok {
+		s.lineCap = v
+	}
+
+	if v, ok := n.attrs["stroke-linejoin"]; ok {
+		s.lineJoin = v
+	}
+
+	if v, ok := parseSvgNumber(n.attrs["stroke-miterlimit"]); ok {
+		s.miterLimit = v
+	}
+
+	if v, ok := n.attrs["color"]; ok && v != "inherit" {
+		s.color = v
+	}
+
+	return s
+}
+
+// basic shapes are built as paths, false means there is nothing to draw
+func buildSvgShape(b *pathBuilder, n *svgNode, viewport point) bool {
+
+	var (
+		diagonal = math.Hypot(viewport.x, viewport.y) / math.Sqrt2
+		length   = func(name string, ref float64) float64 {
+			return parseSvgLength(n.attrs[name], ref, 0)
+		}
+	)
+
+	switch n.name {
+	case "path":
+		parseSvgPath(b, n.attrs["d"])
+	case "rect":
+		var (
+			x      = length("x", viewport.x)
+			y      = length("y", viewport.y)
+			width  = length("width", viewport.x)
+			height = length("height", viewport.y)
+			rx, hx = parseSvgNumber(n.attrs["rx"])
+			ry, hy = parseSvgNumber(n.attrs["ry"])
+		)
+
+		if width <= 0 || height <= 0 {
+			return false
+		}
+
+		// one radius is used for both when the other is missing
+		if !hx {
+			rx = ry
+		}
+
+		if !hy {
+			ry = rx
+		}
+
+		rx = math.Max(0, math.Min(rx, width/2))
+		ry = math.Max(0, math.Min(ry, height/2))
+
+		if rx == 0 || ry == 0 {
+			b.moveTo(point{x, y})
+			b.lineTo(point{x + width, y})
+			b.lineTo(point{x + width, y + height})
+			b.lineTo(point{x, y + height})
+			b.close()
+
+			return true
+		}
+
+		b.moveTo(point{x + rx, y})
+		b.lineTo(point{x + width - rx, y})
+		b.arcTo(rx, ry, 0, false, true, point{x + width, y + ry})
+		b.lineTo(point{x + width, y + height - ry})
+		b.arcTo(rx, ry, 0, false, true, point{x + width - rx, y + height})
+		b.lineTo(point{x + rx, y + height})
+		b.arcTo(rx, ry, 0, false, true, point{x, y + height - ry})
+		b.lineTo(point{x, y + ry})
+		b.arcTo(rx, ry, 0, false, true, point{x + rx, y})
+		b.close()
+	case "circle", "ellipse":
+		var (
+			cx = length("cx", viewport.x)
+			cy = length("cy", viewport.y)
+			rx = length("rx", viewport.x)
+			ry = length("ry", viewport.y)
+		)
+
+		if n.name == "circle" {
+			rx = length("r", diagonal)
+			ry = rx
+		}
+
+		if rx <= 0 || ry <= 0 {
+			return false
+		}
+
+		b.moveTo(point{cx + rx, cy})
+		b.arcTo(rx, ry, 0, false, true, point{cx, cy + ry})
+		b.arcTo(rx, ry, 0, false, true, point{cx - rx, cy})
+		b.arcTo(rx, ry, 0, false, true, point{cx, cy - ry})
+		b.arcTo(rx, ry, 0, false, true, point{cx + rx, cy})
+		b.close()
+	case "line":
+		b.moveTo(point{length("x1", viewport.x), length("y1", viewport.y)})
+		b.lineTo(point{length("x2", viewport.x), length("y2", viewport.y)})
+	case "polyline", "polygon":
+		numbers := parseSvgNumbers(n.attrs["points"])
+
+		for i := 0; i+1 < len(numbers); i += 2 {
+			if i == 0 {
+				b.moveTo(point{numbers[0], numbers[1]})
+			} else {
+				b.lineTo(point{numbers[i], numbers[i+1]})
+			}
+		}
+
+		if n.name == "polygon" {
+			b.close()
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// path data, see https://www.w3.org/TR/SVG11/paths.html#PathData
+func parseSvgPath(b *pathBuilder, d string) {
+
+	var (
+		pos     = 0
+		command byte
+		// the last control point, for the smooth curves
+		control     point
+		lastCommand byte
+	)
+
+	skip := func() {
+		for pos < len(d) && (d[pos] == ' ' || d[pos] == ',' || d[pos] == '\t' || d[pos] == '\n' || d[pos] == '\r') {
+			pos++
+		}
+	}
+
+	number := func() (float64, bool) {
+		skip()
+
+		loc := svgNumberRegexp.FindStringIndex(d[pos:])
+
+		if loc == nil || loc[0] != 0 {
+			return 0, false
+		}
+
+		v, err := strconv.ParseFloat(d[pos:pos+loc[1]], 64)
+
+		pos += loc[1]
+
+		return v, err == nil
+	}
+
+	// arc flags may be written without spaces, ie: a1 1 0 00 1 1
+	flag := func() (bool, bool) {
+		skip()
+
+		if pos < len(d) && (d[pos] == '0' || d[pos] == '1') {
+			pos++
+			return d[pos-1] == '1', true
+		}
+
+		return false, false
+	}
+
+	numbers := func(count int) ([]float64, bool) {
+		list := make([]float64, count)
+
+		for i := range list {
+			v, ok := number()
+
+			if !ok {
+				return nil, false
+			}
+
+			list[i] = v
+		}
+
+		return list, true
+	}
+
+	for {
+		skip()
+
+		if pos >= len(d) {
+			return
+		}
+
+		if c := d[pos]; (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			command = c
+			pos++
+		} else if command == 0 {
+			return
+		}
+
+		var (
+			relative = command >= 'a'
+			origin   point
+			current  = b.last
+		)
+
+		if relative {
+			origin = current
+		}
+
+		switch command | 0x20 {
+		case 'z':
+			b.close()
+			lastCommand = command
+			// a command letter is needed after z
+			command = 0
+			skip()
+
+			if pos < len(d) && !((d[pos] >= 'a' && d[pos] <= 'z') || (d[pos] >= 'A' && d[pos] <= 'Z')) {
+				return
+			}
+
+			continue
+		case 'm':
+			v, ok := numbers(2)
+
+			if !ok {
+				return
+			}
+
+			b.moveTo(origin.add(point{v[0], v[1]}))
+
+			// more pairs after a move are lines
+			if relative {
+				command = 'l'
+			} else {
+				command = 'L'
+			}
+		case 'l':
+			v, ok := numbers(2)
+
+			if !ok {
+				return
+			}
+
+			b.lineTo(origin.add(point{v[0], v[1]}))
+		case 'h':
+			v, ok := numbers(1)
+
+			if !ok {
+				return
+			}
+
+			b.lineTo(point{origin.x + v[0], current.y})
+
+			if !relative {
+				b.last = point{v[0], current.y}
+			}
+		case 'v':
+			v, ok := numbers(1)
+
+			if !ok {
+				return
+			}
+
+			b.lineTo(point{current.x, origin.y + v[0]})
+		case 'c':
+			v, ok := numbers(6)
+
+			if !ok {
+				return
+			}
+
+			control = origin.add(point{v[2], v[3]})
+			b.cubicTo(origin.add(point{v[0], v[1]}), control, origin.add(point{v[4], v[5]}))
+		case 's':
+			v, ok := numbers(4)
+
+			if !ok {
+				return
+			}
+
+			// the first control point is the last one reflected
+			first := current
+
+			if l := lastCommand | 0x20; l == 'c' || l == 's' {
+				first = current.add(current.sub(control))
+			}
+
+			control = origin.add(point{v[0], v[1]})
+			b.cubicTo(first, control, origin.add(point{v[2], v[3]}))
+		case 'q':
+			v, ok := numbers(4)
+
+			if !ok {
+				return
+			}
+
+			control = origin.add(point{v[0], v[1]})
+			b.quadTo(control, origin.add(point{v[2], v[3]}))
+		case 't':
+			v, ok := numbers(2)
+
+			if !ok {
+				return
+			}
+
+			c := current
+
+			if l := lastCommand | 0x20; l == 'q' || l == 't' {
+				c = current.add(current.sub(control))
+			}
+
+			control = c
+			b.quadTo(c, origin.add(point{v[0], v[1]}))
+		case 'a':
+			v, ok := numbers(3)
+
+			if !ok {
+				return
+			}
+
+			large, ok1 := flag()
+			sweep, ok2 := flag()
+			end, ok3 := numbers(2)
+
+			if !ok1 || !ok2 || !ok3 {
+				return
+			}
+
+			b.arcTo(v[0], v[1], v[2], large, sweep, origin.add(point{end[0], end[1]}))
+		default:
+			return
+		}
+
+		lastCommand = command
+	}
+}
+
+func parseSvgTransform(value string) matrix {
+
+	var m = identityMatrix
+
+	for _, match := range svgTransformRegexp.FindAllStringSubmatch(value, -1) {
+		var (
+			v = parseSvgNumbers(match[2])
+			t = identityMatrix
+		)
+
+		arg := func(i int, def float64) float64 {
+			if i < len(v) {
+				return v[i]
+			}
+
+			return def
+		}
+
+		switch match[1] {
+		case "matrix":
+			if len(v) == 6 {
+				t = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+			}
+		case "translate":
+			t = translateMatrix(arg(0, 0), arg(1, 0))
+		case "scale":
+			t = scaleMatrix(arg(0, 1), arg(1, arg(0, 1)))
+		case "rotate":
+			var (
+				a   = arg(0, 0) * math.Pi / 180
+				cx  = arg(1, 0)
+				cy  = arg(2, 0)
+				cos = math.Cos(a)
+				sin = math.Sin(a)
+			)
+
+			t = translateMatrix(cx, cy).mul(matrix{cos, sin, -sin, cos, 0, 0}).mul(translateMatrix(-cx, -cy))
+		case "skewX":
+			t = matrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = matrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		}
+
+		m = m.mul(t)
+	}
+
+	return m
+}
+
+func parseViewBox(value string) ([4]float64, bool) {
+	v := parseSvgNumbers(value)
+
+	if len(v) != 4 {
+		return [4]float64{}, false
+	}
+
+	return [4]float64{v[0], v[1], v[2], v[3]}, true
+}
+
+func parseSvgNumbers(value string) []float64 {
+
+	var list = make([]float64, 0)
+
+	for _, s := range svgNumberRegexp.FindAllString(value, -1) {
+		v, err := strconv.ParseFloat(s, 64)
+
+		if err == nil {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// units are treated as pixels
+func parseSvgNumber(value string) (float64, bool) {
+
+	s := svgNumberRegexp.FindString(strings.TrimSpace(value))
+
+	if s == "" || !strings.HasPrefix(strings.TrimSpace(value), s) {
+		return 0, false
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+
+	return v, err == nil
+}
+
+// a length in user units, percentages are relative to ref
+func parseSvgLength(value string, ref float64, def float64) float64 {
+
+	v, ok := parseSvgNumber(value)
+
+	if !ok {
+		return def
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(value), "%") {
+		return v / 100 * ref
+	}
+
+	return v
+}
+
+func parseSvgOpacity(value string) float64 {
+
+	v, ok := parseSvgNumber(value)
+
+	if !ok {
+		return 1
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(value), "%") {
+		v /= 100
+	}
+
+	return math.Max(0, math.Min(1, v))
+}
+
+// hex, rgb(), rgba() and some named colors
+func parseSvgColor(value string) (color.NRGBA, bool) {
+
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if c, ok := svgNamedColors[value]; ok {
+		return c, true
+	}
+
+	if strings.HasPrefix(value, "#") {
+		c, err := ParseHexColor(value)
+
+		return c, err == nil
+	}
+
+	if !strings.HasPrefix(value, "rgb") {
+		return color.NRGBA{}, false
+	}
+
+	var (
+		start = strings.Index(value, "(")
+		end   = strings.LastIndex(value, ")")
+	)
+
+	if start < 0 || end < start {
+		return color.NRGBA{}, false
+	}
+
+	parts := strings.FieldsFunc(value[start+1:end], func(r rune) bool {
+		return r == ',' || r == ' ' || r == '/'
+	})
+
+	if len(parts) < 3 {
+		return color.NRGBA{}, false
+	}
+
+	var channels [3]uint8
+
+	for i := 0; i < 3; i++ {
+		channels[i] = uint8(math.Max(0, math.Min(255, parseSvgLength(parts[i], 255, 0)+0.5)))
+	}
+
+	c := color.NRGBA{channels[0], channels[1], channels[2], 255}
+
+	if len(parts) > 3 {
+		c.A = uint8(parseSvgOpacity(parts[3])*255 + 0.5)
+	}
+
+	return c, true
+}
+
+// the root of an svg file, so the file can be put into another svg
+type SVGFragment struct {
+	// attributes of the root as they are written, ie: xmlns:xlink, without the quotes
+	Attrs [][2]string
+	// everything inside the root
+	Content []byte
+	Width   float64
+	Height  float64
+	ViewBox string
+}
+
+var (
+	svgAttrRegexp = regexp.MustCompile(`([^\s=/<>]+)\s*=\s*("[^"]*"|'[^']*')`)
+	svgIdRegexp   = regexp.MustCompile(`(\sid\s*=\s*["'])`)
+	svgUrlRegexp  = regexp.MustCompile(`(url\(\s*["']?)#`)
+	svgHrefRegexp = regexp.MustCompile(`(href\s*=\s*["'])#`)
+	// <style> blocks, the content is the second group
+	svgStyleRegexp = regexp.MustCompile(`(?is)(<style\b[^>]*>)(.*?)(</style\s*>)`)
+)
+
+// ReadSVGFragment splits an svg file into the attributes of the root and its content
+func ReadSVGFragment(data []byte) (*SVGFragment, error) {
+
+	root, err := parseSVG(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	width, height, err := getSvgSize(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		decoder  = xml.NewDecoder(bytes.NewReader(data))
+		fragment = &SVGFragment{Width: width, Height: height, ViewBox: fmt.Sprintf("0 0 %g %g", width, height)}
+		depth    = 0
+		start    = int64(-1)
+		offset   int64
+	)
+
+	if _, ok := parseViewBox(root.attrs["viewBox"]); ok {
+		fragment.ViewBox = root.attrs["viewBox"]
+	}
+
+	decoder.Strict = false
+
+	for {
+		offset = decoder.InputOffset()
+
+		token, err := decoder.Token()
+
+		if err != nil {
+			return nil, errors.New("svg: the root element is not closed")
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+
+			if depth == 1 {
+				for _, m := range svgAttrRegexp.FindAllSubmatch(data[offset:decoder.InputOffset()], -1) {
+					fragment.Attrs = append(fragment.Attrs, [2]string{string(m[1]), string(m[2][1 : len(m[2])-1])})
+				}
+
+				start = decoder.InputOffset()
+			}
+		case xml.EndElement:
+			depth--
+
+			if depth == 0 {
+				fragment.Content = data[start:offset]
+				return fragment, nil
+			}
+		}
+	}
+}
+
+// PrefixSVGIds puts the prefix before the ids and the links to them, so svg files do not mix up with each other in one document
+func PrefixSVGIds(content []byte, prefix string) []byte {
+	content = svgIdRegexp.ReplaceAll(content, []byte("${1}"+prefix))
+	content = svgUrlRegexp.ReplaceAll(content, []byte("${1}#"+prefix))
+	content = svgHrefRegexp.ReplaceAll(content, []byte("${1}#"+prefix))
+
+	// id selectors of the style blocks, the urls in them are already prefixed above
+	content = svgStyleRegexp.ReplaceAllFunc(content, func(block []byte) []byte {
+		m := svgStyleRegexp.FindSubmatch(block)
+
+		return bytes.Join([][]byte{m[1], prefixCSSIds(m[2], prefix), m[3]}, nil)
+	})
+
+	return content
+}
+
+// at-rules holding other rules, their blocks have selectors too
+var cssGroupRules = map[string]bool{"@media": true, "@supports": true, "@document": true, "@layer": true, "@container": true}
+
+// puts the prefix after '#' in the selectors of the css, colors like #fff in the declarations are kept
+func prefixCSSIds(css []byte, prefix string) []byte {
+
+	var (
+		b = bytes.Buffer{}
+		// whether every open block holds rules instead of declarations
+		blocks = make([]bool, 0)
+		// where the selector or at-rule in front of the next block starts
+		start = 0
+	)
+
+	inRules := func() bool {
+		return len(blocks) == 0 || blocks[len(blocks)-1]
+	}
+
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+
+		switch {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := bytes.Index(css[i+2:], []byte("*/"))
+
+			if end < 0 {
+				end = len(css)
+			} else {
+				end += i + 4
+			}
+
+			b.Write(css[i:end])
+			i = end - 1
+		case c == '"' || c == '\'':
+			end := i + 1
+
+			for end < len(css) && css[end] != c {
+				if css[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			end = minInt(end+1, len(css))
+
+			b.Write(css[i:end])
+			i = end - 1
+		case c == '{':
+			prelude := strings.TrimSpace(string(css[start:i]))
+			name := strings.ToLower(strings.SplitN(prelude, " ", 2)[0])
+
+			blocks = append(blocks, inRules() && cssGroupRules[name])
+			start = i + 1
+
+			b.WriteByte(c)
+		case c == '}':
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+
+			start = i + 1
+
+			b.WriteByte(c)
+		case c == ';':
+			start = i + 1
+
+			b.WriteByte(c)
+		case c == '#' && inRules() && i+1 < len(css) && isCSSNameStart(css[i+1]) && !strings.HasPrefix(strings.TrimSpace(string(css[start:i])), "@"):
+			b.WriteByte(c)
+			b.WriteString(prefix)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.Bytes()
+}
+
+func isCSSNameStart(c byte) bool {
+	return c == '_' || c == '-' || c == '\\' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
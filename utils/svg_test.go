@@ -0,0 +1,370 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	svgRed   = color.RGBA{255, 0, 0, 255}
+	svgBlue  = color.RGBA{0, 0, 255, 255}
+	svgEmpty = color.RGBA{}
+)
+
+func rasterizeTestSvg(t *testing.T, src string, width, height int) *image.RGBA {
+	t.Helper()
+
+	img, err := RasterizeSVG([]byte(src), width, height)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// anti-aliasing and gradients are not exact, every channel can be off by the tolerance
+func assertSvgPixel(t *testing.T, name string, img *image.RGBA, x, y int, want color.RGBA, tolerance int) {
+	t.Helper()
+
+	var (
+		got = img.RGBAAt(x, y)
+		a   = [4]int{int(got.R), int(got.G), int(got.B), int(got.A)}
+		b   = [4]int{int(want.R), int(want.G), int(want.B), int(want.A)}
+	)
+
+	for i := range a {
+		if a[i]-b[i] > tolerance || b[i]-a[i] > tolerance {
+			t.Errorf("%s: pixel (%d, %d) is %v, want %v", name, x, y, got, want)
+			return
+		}
+	}
+}
+
+func TestRasterizeSVGShapes(t *testing.T) {
+
+	var cases = []struct {
+		name   string
+		svg    string
+		inside [][2]int
+		empty  [][2]int
+	}{
+		{
+			name:   "rect",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect x="2" y="2" width="4" height="4" fill="#ff0000"/></svg>`,
+			inside: [][2]int{{2, 2}, {3, 3}, {5, 5}},
+			empty:  [][2]int{{1, 1}, {6, 6}, {8, 8}},
+		},
+		{
+			name:   "path with lines",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><path d="M0 0 L10 0 L0 10 Z" fill="red"/></svg>`,
+			inside: [][2]int{{1, 1}, {6, 1}, {1, 6}},
+			empty:  [][2]int{{8, 8}, {6, 6}},
+		},
+		{
+			name:   "relative path",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><path d="m2 2 h6 v6 h-6 z" fill="rgb(255,0,0)"/></svg>`,
+			inside: [][2]int{{2, 2}, {7, 7}},
+			empty:  [][2]int{{1, 5}, {8, 5}},
+		},
+		{
+			name:   "arcs",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><path d="M10 0 A10 10 0 0 1 10 20 A10 10 0 0 1 10 0 Z" fill="red"/></svg>`,
+			inside: [][2]int{{10, 10}, {1, 10}, {18, 10}, {10, 1}},
+			empty:  [][2]int{{0, 0}, {19, 19}, {1, 1}},
+		},
+		{
+			name:   "cubic curve",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><path d="M0 20 C0 0 20 0 20 20 Z" fill="red"/></svg>`,
+			inside: [][2]int{{10, 10}, {10, 18}},
+			empty:  [][2]int{{1, 1}, {18, 1}},
+		},
+		{
+			name:   "circle",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><circle cx="10" cy="10" r="6" fill="red"/></svg>`,
+			inside: [][2]int{{10, 10}, {5, 10}},
+			empty:  [][2]int{{2, 2}, {10, 2}},
+		},
+		{
+			name:   "even odd",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><path d="M0 0 H20 V20 H0 Z M5 5 H15 V15 H5 Z" fill="red" fill-rule="evenodd"/></svg>`,
+			inside: [][2]int{{2, 2}, {17, 17}},
+			empty:  [][2]int{{10, 10}},
+		},
+		{
+			name:   "nonzero",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><path d="M0 0 H20 V20 H0 Z M5 5 H15 V15 H5 Z" fill="red"/></svg>`,
+			inside: [][2]int{{2, 2}, {10, 10}},
+		},
+		{
+			name:   "stroke",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><line x1="0" y1="10" x2="20" y2="10" stroke="red" stroke-width="4"/></svg>`,
+			inside: [][2]int{{5, 9}, {15, 10}},
+			empty:  [][2]int{{5, 5}, {5, 14}},
+		},
+		{
+			name:   "use",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="20" height="20"><defs><rect id="box" width="5" height="5" fill="red"/></defs><use xlink:href="#box" x="10" y="10"/></svg>`,
+			inside: [][2]int{{12, 12}},
+			empty:  [][2]int{{2, 2}},
+		},
+	}
+
+	for _, c := range cases {
+		img := rasterizeTestSvg(t, c.svg, svgTestSize(c.svg), svgTestSize(c.svg))
+
+		for _, p := range c.inside {
+			assertSvgPixel(t, c.name, img, p[0], p[1], svgRed, 0)
+		}
+
+		for _, p := range c.empty {
+			assertSvgPixel(t, c.name, img, p[0], p[1], svgEmpty, 0)
+		}
+	}
+}
+
+// the test svgs are drawn at their own size
+func svgTestSize(svg string) int {
+	w, _, err := SVGSize([]byte(svg))
+
+	if err != nil {
+		return 0
+	}
+
+	return int(w)
+}
+
+func TestRasterizeSVGTransforms(t *testing.T) {
+
+	var cases = []struct {
+		name   string
+		svg    string
+		inside [][2]int
+		empty  [][2]int
+	}{
+		{
+			name:   "translate",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><g transform="translate(5,0)"><rect width="5" height="10" fill="red"/></g></svg>`,
+			inside: [][2]int{{7, 5}},
+			empty:  [][2]int{{2, 5}},
+		},
+		{
+			name:   "scale",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="2" height="2" transform="scale(3)" fill="red"/></svg>`,
+			inside: [][2]int{{5, 5}},
+			empty:  [][2]int{{7, 7}},
+		},
+		{
+			name:   "rotate around a point",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="5" height="10" transform="rotate(90 5 5)" fill="red"/></svg>`,
+			inside: [][2]int{{2, 2}, {7, 2}},
+			empty:  [][2]int{{2, 7}, {7, 7}},
+		},
+		{
+			name:   "nested",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><g transform="translate(10 10)"><g transform="scale(2)"><rect width="2" height="2" fill="red"/></g></g></svg>`,
+			inside: [][2]int{{11, 11}, {13, 13}},
+			empty:  [][2]int{{9, 9}, {15, 15}},
+		},
+		{
+			name:   "matrix",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="5" height="5" transform="matrix(1 0 0 1 5 5)" fill="red"/></svg>`,
+			inside: [][2]int{{7, 7}},
+			empty:  [][2]int{{2, 2}},
+		},
+	}
+
+	for _, c := range cases {
+		img := rasterizeTestSvg(t, c.svg, svgTestSize(c.svg), svgTestSize(c.svg))
+
+		for _, p := range c.inside {
+			assertSvgPixel(t, c.name, img, p[0], p[1], svgRed, 0)
+		}
+
+		for _, p := range c.empty {
+			assertSvgPixel(t, c.name, img, p[0], p[1], svgEmpty, 0)
+		}
+	}
+}
+
+func TestRasterizeSVGViewBox(t *testing.T) {
+
+	// scaled up 10 times
+	img := rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect x="2" y="2" width="4" height="4" fill="red"/></svg>`, 100, 100)
+
+	assertSvgPixel(t, "scaled", img, 20, 20, svgRed, 0)
+	assertSvgPixel(t, "scaled", img, 59, 59, svgRed, 0)
+	assertSvgPixel(t, "scaled", img, 19, 19, svgEmpty, 0)
+	assertSvgPixel(t, "scaled", img, 60, 60, svgEmpty, 0)
+
+	// the size without a viewBox is scaled like one
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="5" height="5" fill="red"/></svg>`, 40, 40)
+
+	assertSvgPixel(t, "size", img, 19, 19, svgRed, 0)
+	assertSvgPixel(t, "size", img, 20, 20, svgEmpty, 0)
+
+	// a tall viewBox is centered in a square image
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 20"><rect width="10" height="20" fill="red"/></svg>`, 100, 100)
+
+	assertSvgPixel(t, "centered", img, 50, 50, svgRed, 0)
+	assertSvgPixel(t, "centered", img, 10, 50, svgEmpty, 0)
+	assertSvgPixel(t, "centered", img, 90, 50, svgEmpty, 0)
+
+	// the viewBox can start anywhere
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="10 10 10 10"><rect x="10" y="10" width="5" height="5" fill="red"/></svg>`, 10, 10)
+
+	assertSvgPixel(t, "origin", img, 2, 2, svgRed, 0)
+	assertSvgPixel(t, "origin", img, 7, 7, svgEmpty, 0)
+}
+
+func TestRasterizeSVGGradients(t *testing.T) {
+
+	img := rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="10">
+	<defs><linearGradient id="g"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue"/></linearGradient></defs>
+	<rect width="100" height="10" fill="url(#g)"/>
+</svg>`, 100, 10)
+
+	assertSvgPixel(t, "linear", img, 0, 5, svgRed, 4)
+	assertSvgPixel(t, "linear", img, 99, 5, svgBlue, 4)
+	assertSvgPixel(t, "linear", img, 50, 5, color.RGBA{127, 0, 127, 255}, 4)
+
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100">
+	<defs><radialGradient id="g"><stop offset="0" stop-color="#ff0000"/><stop offset="1" stop-color="#0000ff"/></radialGradient></defs>
+	<rect width="100" height="100" fill="url(#g)"/>
+</svg>`, 100, 100)
+
+	assertSvgPixel(t, "radial", img, 50, 50, svgRed, 8)
+	assertSvgPixel(t, "radial", img, 50, 1, svgBlue, 8)
+	// beyond the last stop the color is padded
+	assertSvgPixel(t, "radial", img, 0, 0, svgBlue, 0)
+
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="100">
+	<defs><linearGradient id="g" x1="0" y1="0" x2="0" y2="100" gradientUnits="userSpaceOnUse"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue"/></linearGradient></defs>
+	<rect width="10" height="100" fill="url(#g)"/>
+</svg>`, 10, 100)
+
+	assertSvgPixel(t, "user space", img, 5, 0, svgRed, 4)
+	assertSvgPixel(t, "user space", img, 5, 99, svgBlue, 4)
+}
+
+func TestRasterizeSVGOpacity(t *testing.T) {
+
+	img := rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10" fill="red" fill-opacity="0.5"/></svg>`, 10, 10)
+
+	// premultiplied
+	assertSvgPixel(t, "fill-opacity", img, 5, 5, color.RGBA{128, 0, 0, 128}, 1)
+
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><g opacity="0.5"><rect width="10" height="10" fill="red"/></g></svg>`, 10, 10)
+
+	assertSvgPixel(t, "group opacity", img, 5, 5, color.RGBA{128, 0, 0, 128}, 1)
+
+	img = rasterizeTestSvg(t, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10" fill="red"/><rect width="10" height="10" fill="none" stroke="none"/></svg>`, 10, 10)
+
+	assertSvgPixel(t, "none", img, 5, 5, svgRed, 0)
+}
+
+func TestSVGSize(t *testing.T) {
+
+	var cases = []struct {
+		svg           string
+		width, height float64
+		ok            bool
+	}{
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="30" height="20"/>`, 30, 20, true},
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="30px" height="20px" viewBox="0 0 3 2"/>`, 30, 20, true},
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="100%" height="100%" viewBox="0 0 3 2"/>`, 3, 2, true},
+		{`<svg xmlns="http://www.w3.org/2000/svg" viewBox="5,5,40,50"/>`, 40, 50, true},
+		{`<svg xmlns="http://www.w3.org/2000/svg"/>`, 0, 0, false},
+		{`<html/>`, 0, 0, false},
+	}
+
+	for _, c := range cases {
+		width, height, err := SVGSize([]byte(c.svg))
+
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v", c.svg, err)
+			continue
+		}
+
+		if width != c.width || height != c.height {
+			t.Errorf("%s: size %gx%g, want %gx%g", c.svg, width, height, c.width, c.height)
+		}
+	}
+}
+
+func TestReadSVGFragment(t *testing.T) {
+
+	f, err := ReadSVGFragment([]byte(`<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="64" height="32" viewBox="0 0 32 16" fill='none'><g><rect width="1" height="1"/></g></svg>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Width != 64 || f.Height != 32 || f.ViewBox != "0 0 32 16" {
+		t.Errorf("size %gx%g viewBox '%s', want 64x32 '0 0 32 16'", f.Width, f.Height, f.ViewBox)
+	}
+
+	if want := `<g><rect width="1" height="1"/></g>`; string(f.Content) != want {
+		t.Errorf("content '%s', want '%s'", f.Content, want)
+	}
+
+	var attrs = make(map[string]string, 0)
+
+	for _, a := range f.Attrs {
+		attrs[a[0]] = a[1]
+	}
+
+	if attrs["fill"] != "none" || attrs["width"] != "64" {
+		t.Errorf("attrs %v", f.Attrs)
+	}
+
+	if _, err := ReadSVGFragment([]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"><g>`)); err == nil {
+		t.Error("no error for an unclosed svg")
+	}
+}
+
+func TestPrefixSVGIds(t *testing.T) {
+
+	var (
+		src  = `<linearGradient id="g"/><path id='p' fill="url(#g)" stroke="url( '#g')"/><use href="#p"/><use xlink:href='#p'/><a data-id="x" href="https://example.com/#top"/>`
+		want = `<linearGradient id="e7-g"/><path id='e7-p' fill="url(#e7-g)" stroke="url( '#e7-g')"/><use href="#e7-p"/><use xlink:href='#e7-p'/><a data-id="x" href="https://example.com/#top"/>`
+	)
+
+	if got := string(PrefixSVGIds([]byte(src), "e7-")); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// the prefixed svg still draws the same
+	var (
+		svg      = `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><defs><linearGradient id="g"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="red"/></linearGradient></defs><rect width="10" height="10" fill="url(#g)"/></svg>`
+		prefixed = string(PrefixSVGIds([]byte(svg), "e7-"))
+	)
+
+	assertSvgPixel(t, "prefixed", rasterizeTestSvg(t, prefixed, 10, 10), 5, 5, svgRed, 0)
+}
+
+func TestPrefixSVGStyleIds(t *testing.T) {
+
+	var (
+		src = `<style type="text/css"><![CDATA[
+/* #note stays */
+#a, g > #b.c:hover, .d { fill: #fff; stroke: url(#g); font-family: "#x" }
+@media (min-width: 10px) { #a { fill: #ABCDEF } }
+@font-face { font-family: f; src: url(f.woff) }
+[data-x="#y"] { fill: red }
+]]></style><rect id="a" style="fill:#000"/>`
+		want = `<style type="text/css"><![CDATA[
+/* #note stays */
+#e7-a, g > #e7-b.c:hover, .d { fill: #fff; stroke: url(#e7-g); font-family: "#x" }
+@media (min-width: 10px) { #e7-a { fill: #ABCDEF } }
+@font-face { font-family: f; src: url(f.woff) }
+[data-x="#y"] { fill: red }
+]]></style><rect id="e7-a" style="fill:#000"/>`
+	)
+
+	if got := string(PrefixSVGIds([]byte(src), "e7-")); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+// tint
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	TintMultiply = "multiply"
+	TintHue      = "hue"
+	TintMap      = "map"
+)
+
+// Tint colors a greyscale image, the alpha is kept.
+// multiply: every channel is multiplied by colors[0], white becomes the color and black stays black.
+// hue: the hue and saturation of colors[0] with the lightness of every pixel.
+// map: the lightness of every pixel picks a color from colors, which go from black to white.
+// 为灰度图上色, 保留原有的透明度
+func Tint(src image.Image, mode string, colors []color.NRGBA) *image.NRGBA {
+
+	var (
+		b   = src.Bounds()
+		dst = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+		tint   = colors[0]
+		th, ts = 0.0, 0.0
+	)
+
+	if mode == TintHue {
+		th, ts, _ = RGBToHSL(tint.R, tint.G, tint.B)
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := color.NRGBAModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+
+			if c.A == 0 {
+				continue
+			}
+
+			var out color.NRGBA
+
+			switch mode {
+			case TintHue:
+				_, _, l := RGBToHSL(c.R, c.G, c.B)
+				rgb := HSLToRGB(th, ts, l)
+				out = color.NRGBA{rgb.R, rgb.G, rgb.B, mulChannel(c.A, tint.A)}
+			case TintMap:
+				out = GradientColor(colors, getLuminance(c))
+				out.A = mulChannel(c.A, out.A)
+			default:
+				out = color.NRGBA{mulChannel(c.R, tint.R), mulChannel(c.G, tint.G), mulChannel(c.B, tint.B), mulChannel(c.A, tint.A)}
+			}
+
+			dst.SetNRGBA(x, y, out)
+		}
+	}
+
+	return dst
+}
+
+// GradientColor picks the color at t (0 ~ 1) of the stops, which are spread evenly
+func GradientColor(stops []color.NRGBA, t float64) color.NRGBA {
+
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+
+	i := int(t)
+
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+
+	var (
+		from = stops[i]
+		to   = stops[i+1]
+		frac = t - float64(i)
+	)
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*frac + 0.5)
+	}
+
+	return color.NRGBA{lerp(from.R, to.R), lerp(from.G, to.G), lerp(from.B, to.B), lerp(from.A, to.A)}
+}
+
+// RGBToHSL returns hue, saturation and lightness, all of them are 0 ~ 1
+func RGBToHSL(r, g, b uint8) (float64, float64, float64) {
+
+	var (
+		rf = float64(r) / 255
+		gf = float64(g) / 255
+		bf = float64(b) / 255
+
+		max = math.Max(rf, math.Max(gf, bf))
+		min = math.Min(rf, math.Min(gf, bf))
+
+		l = (max + min) / 2
+	)
+
+	if max == min {
+		// it's gray
+		return 0, 0, l
+	}
+
+	var (
+		d = max - min
+		s float64
+		h float64
+	)
+
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+
+	switch max {
+	case rf:
+		h = (gf - bf) / d
+
+		if gf < bf {
+			h += 6
+		}
+	case gf:
+		h = (bf-rf)/d + 2
+	default:
+		h = (rf-gf)/d + 4
+	}
+
+	return h / 6, s, l
+}
+
+func getLuminance(c color.NRGBA) float64 {
+	return (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+}
+
+func mulChannel(a, b uint8) uint8 {
+	return uint8((int(a)*int(b) + 127) / 255)
+}
@@ -0,0 +1,807 @@
+// webp
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// only the lossless format (VP8L) is written, with the subtract green and predictor transforms,
+// backward references and prefix codes. see https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+// 只支持无损格式(VP8L), 使用减绿变换、预测变换、向后引用以及前缀编码
+
+const (
+	webpMaxSize = 1 << 14
+
+	// predictor blocks are 16x16
+	webpPredictorBits = 4
+
+	webpNumLiteral   = 256
+	webpNumLength    = 24
+	webpNumDistance  = 40
+	webpMaxCodeLen   = 15
+	webpMaxCLCodeLen = 7
+
+	webpMinMatch      = 3
+	webpMaxMatch      = 4096
+	webpMaxDistance   = 1<<20 - 200
+	webpHashBits      = 16
+	webpMaxChainCheck = 16
+)
+
+var webpCodeLengthOrder = []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes the image as a lossless webp
+func EncodeWebP(w io.Writer, img image.Image) error {
+
+	var (
+		b      = img.Bounds()
+		width  = b.Dx()
+		height = b.Dy()
+	)
+
+	if width < 1 || height < 1 || width > webpMaxSize || height > webpMaxSize {
+		return errors.New("webp: width and height should be 1 ~ 16384")
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	var (
+		argb     = make([]uint32, width*height)
+		hasAlpha = false
+	)
+
+	for i := range argb {
+		p := nrgba.Pix[i*4 : i*4+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+
+		if p[3] != 0xff {
+			hasAlpha = true
+		}
+	}
+
+	bw := &bitWriter{}
+
+	// header
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+
+	bw.write(0, 3)
+
+	// subtract green transform
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p>>16)&0xff - g) & 0xff
+		bl := (p&0xff - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | bl
+	}
+
+	// predictor transform
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(webpPredictorBits-2, 3)
+
+	modes, modeWidth := choosePredictors(argb, width, height)
+
+	writeImageData(bw, modes, modeWidth, false)
+
+	residuals := applyPredictors(argb, width, height, modes, modeWidth)
+
+	// no more transforms
+	bw.write(0, 1)
+
+	writeImageData(bw, residuals, width, true)
+
+	data := bw.bytes()
+
+	var header [20]byte
+
+	size := len(data) + len(data)%2
+
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(12+size))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	// chunks are padded to even sizes
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// bits are written from the lowest one
+func (bw *bitWriter) write(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.nbits
+	bw.nbits += n
+
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc = 0
+		bw.nbits = 0
+	}
+
+	return bw.buf
+}
+
+// predict a pixel with the pixels on the left and top of it, i is the index of the pixel
+func predictPixel(mode uint32, argb []uint32, i int, width int) uint32 {
+
+	var (
+		l  = argb[i-1]
+		t  = argb[i-width]
+		tl = argb[i-width-1]
+		// the top right of the last column is the first pixel of the current row
+		tr = argb[i-width+1]
+	)
+
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return mapChannels(func(c int) int {
+			return channel(l, c) + channel(t, c) - channel(tl, c)
+		})
+	}
+
+	a := average2(l, t)
+
+	return mapChannels(func(c int) int {
+		return channel(a, c) + (channel(a, c)-channel(tl, c))/2
+	})
+}
+
+func channel(p uint32, c int) int {
+	return int(p>>(uint(c)*8)) & 0xff
+}
+
+// clamp every channel to 0 ~ 255
+func mapChannels(f func(c int) int) uint32 {
+	var p uint32
+
+	for c := 0; c < 4; c++ {
+		v := f(c)
+
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+
+		p |= uint32(v) << (uint(c) * 8)
+	}
+
+	return p
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPixel(l, t, tl uint32) uint32 {
+	var pl, pt int
+
+	for c := 0; c < 4; c++ {
+		estimate := channel(l, c) + channel(t, c) - channel(tl, c)
+
+		pl += abs(estimate - channel(l, c))
+		pt += abs(estimate - channel(t, c))
+	}
+
+	if pl < pt {
+		return l
+	}
+
+	return t
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+// per channel subtraction, wrapped in 0 ~ 255
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+
+	for c := uint(0); c < 32; c += 8 {
+		p |= ((a>>c - b>>c) & 0xff) << c
+	}
+
+	return p
+}
+
+// the predictor of the pixel, the first row and column always use the left and top pixel
+func getPredictor(argb []uint32, x, y, width int, mode uint32) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[y*width+x-1]
+	case x == 0:
+		return argb[(y-1)*width]
+	}
+
+	return predictPixel(mode, argb, y*width+x, width)
+}
+
+// the mode of every block is the one with the smallest residuals
+func choosePredictors(argb []uint32, width, height int) ([]uint32, int) {
+
+	var (
+		size       = 1 << webpPredictorBits
+		modeWidth  = (width + size - 1) / size
+		modeHeight = (height + size - 1) / size
+		modes      = make([]uint32, modeWidth*modeHeight)
+	)
+
+	for by := 0; by < modeHeight; by++ {
+		for bx := 0; bx < modeWidth; bx++ {
+
+			var (
+				best     uint32 = 0
+				bestCost        = -1
+			)
+
+			for mode := uint32(0); mode < 14; mode++ {
+				cost := 0
+
+				for y := by * size; y < (by+1)*size && y < height; y++ {
+					for x := bx * size; x < (bx+1)*size && x < width; x++ {
+						r := subPixels(argb[y*width+x], getPredictor(argb, x, y, width, mode))
+
+						for c := 0; c < 4; c++ {
+							cost += abs(int(int8(channel(r, c))))
+						}
+					}
+				}
+
+				if bestCost < 0 || cost < bestCost {
+					best = mode
+					bestCost = cost
+				}
+			}
+
+			// the mode is saved in the green channel
+			modes[by*modeWidth+bx] = 0xff000000 | best<<8
+		}
+	}
+
+	return modes, modeWidth
+}
+
+func applyPredictors(argb []uint32, width, height int, modes []uint32, modeWidth int) []uint32 {
+
+	residuals := make([]uint32, len(argb))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := (modes[(y>>webpPredictorBits)*modeWidth+x>>webpPredictorBits] >> 8) & 0xff
+
+			residuals[y*width+x] = subPixels(argb[y*width+x], getPredictor(argb, x, y, width, mode))
+		}
+	}
+
+	return residuals
+}
+
+// a pixel, or a copy of the pixels before
+type webpToken struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+func findBackwardRefs(argb []uint32, width int) []webpToken {
+
+	var (
+		tokens = make([]webpToken, 0, len(argb))
+		head   = make([]int32, 1<<webpHashBits)
+		prev   = make([]int32, len(argb))
+	)
+
+	for i := range head {
+		head[i] = -1
+	}
+
+	hash := func(i int) uint32 {
+		return ((argb[i] * 0x9e3779b1) ^ (argb[i+1] * 0x85ebca6b)) >> (32 - webpHashBits) & (1<<webpHashBits - 1)
+	}
+
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	for i := 0; i < len(argb); {
+
+		var bestLen, bestDist = 0, 0
+
+		if i+1 < len(argb) {
+			candidate := head[hash(i)]
+
+			for checks := 0; candidate >= 0 && checks < webpMaxChainCheck && i-int(candidate) <= webpMaxDistance; checks++ {
+				j := int(candidate)
+
+				n := 0
+
+				for n < webpMaxMatch && i+n < len(argb) && argb[j+n] == argb[i+n] {
+					n++
+				}
+
+				if n > bestLen {
+					bestLen = n
+					bestDist = i - j
+				}
+
+				candidate = prev[j]
+			}
+		}
+
+		if bestLen >= webpMinMatch {
+			tokens = append(tokens, webpToken{length: bestLen, distance: bestDist})
+
+			for k := 0; k < bestLen; k++ {
+				insert(i + k)
+			}
+
+			i += bestLen
+
+			continue
+		}
+
+		tokens = append(tokens, webpToken{argb: argb[i]})
+
+		insert(i)
+
+		i++
+	}
+
+	return tokens
+}
+
+// distance codes 1 ~ 120 are short cuts for near pixels, only the pixel on the left and the one on the top are used here
+func getDistanceCode(distance int, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+
+	return distance + 120
+}
+
+// values are written as a prefix symbol and the extra bits
+func getPrefix(value int) (int, int, int) {
+	if value <= 4 {
+		return value - 1, 0, 0
+	}
+
+	var (
+		v    = value - 1
+		high = 0
+	)
+
+	for v>>uint(high+1) != 0 {
+		high++
+	}
+
+	second := (v >> uint(high-1)) & 1
+	extraBits := high - 1
+
+	return 2*high + second, extraBits, v & (1<<uint(extraBits) - 1)
+}
+
+// the entropy coded image: no color cache, one group of prefix codes, and backward references for the main image
+func writeImageData(bw *bitWriter, argb []uint32, width int, isMain bool) {
+
+	var tokens []webpToken
+
+	if isMain {
+		tokens = findBackwardRefs(argb, width)
+	} else {
+		tokens = make([]webpToken, len(argb))
+
+		for i, p := range argb {
+			tokens[i] = webpToken{argb: p}
+		}
+	}
+
+	var (
+		green    = make([]uint32, webpNumLiteral+webpNumLength)
+		red      = make([]uint32, webpNumLiteral)
+		blue     = make([]uint32, webpNumLiteral)
+		alpha    = make([]uint32, webpNumLiteral)
+		distance = make([]uint32, webpNumDistance)
+	)
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[(t.argb>>8)&0xff]++
+			red[(t.argb>>16)&0xff]++
+			blue[t.argb&0xff]++
+			alpha[t.argb>>24]++
+			continue
+		}
+
+		prefix, _, _ := getPrefix(t.length)
+		green[webpNumLiteral+prefix]++
+
+		prefix, _, _ = getPrefix(getDistanceCode(t.distance, width))
+		distance[prefix]++
+	}
+
+	// no color cache
+	bw.write(0, 1)
+
+	if isMain {
+		// no meta prefix codes
+		bw.write(0, 1)
+	}
+
+	codes := []*huffmanCode{
+		newHuffmanCode(green, webpMaxCodeLen),
+		newHuffmanCode(red, webpMaxCodeLen),
+		newHuffmanCode(blue, webpMaxCodeLen),
+		newHuffmanCode(alpha, webpMaxCodeLen),
+		newHuffmanCode(distance, webpMaxCodeLen),
+	}
+
+	for _, c := range codes {
+		c.writeHeader(bw)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].writeSymbol(bw, int(t.argb>>8)&0xff)
+			codes[1].writeSymbol(bw, int(t.argb>>16)&0xff)
+			codes[2].writeSymbol(bw, int(t.argb)&0xff)
+			codes[3].writeSymbol(bw, int(t.argb>>24))
+			continue
+		}
+
+		prefix, extraBits, extra := getPrefix(t.length)
+		codes[0].writeSymbol(bw, webpNumLiteral+prefix)
+		bw.write(uint32(extra), uint(extraBits))
+
+		prefix, extraBits, extra = getPrefix(getDistanceCode(t.distance, width))
+		codes[4].writeSymbol(bw, prefix)
+		bw.write(uint32(extra), uint(extraBits))
+	}
+}
+
+type huffmanCode struct {
+	lengths []uint8
+	// bits are reversed, as they are read from the lowest one
+	codes []uint32
+	// with only one symbol, it takes no bit
+	symbols []int
+}
+
+func newHuffmanCode(counts []uint32, maxLength int) *huffmanCode {
+
+	h := &huffmanCode{
+		lengths: make([]uint8, len(counts)),
+		codes:   make([]uint32, len(counts)),
+		symbols: make([]int, 0),
+	}
+
+	for s, c := range counts {
+		if c > 0 {
+			h.symbols = append(h.symbols, s)
+		}
+	}
+
+	if len(h.symbols) == 0 {
+		return h
+	}
+
+	if len(h.symbols) == 1 {
+		h.lengths[h.symbols[0]] = 1
+		return h
+	}
+
+	// raise the small counts until the tree is short enough
+	for countMin := uint32(1); ; countMin *= 2 {
+		adjusted := make([]uint32, len(counts))
+
+		for _, s := range h.symbols {
+			adjusted[s] = counts[s]
+
+			if adjusted[s] < countMin {
+				adjusted[s] = countMin
+			}
+		}
+
+		if getHuffmanLengths(adjusted, h.symbols, h.lengths) <= maxLength {
+			break
+		}
+	}
+
+	// canonical codes
+	var (
+		lengthCount = make([]uint32, maxLength+1)
+		nextCode    = make([]uint32, maxLength+2)
+	)
+
+	for _, l := range h.lengths {
+		lengthCount[l]++
+	}
+
+	lengthCount[0] = 0
+
+	for l := 1; l <= maxLength; l++ {
+		nextCode[l+1] = (nextCode[l] + lengthCount[l]) << 1
+	}
+
+	for s, l := range h.lengths {
+		if l == 0 {
+			continue
+		}
+
+		code := nextCode[l]
+		nextCode[l]++
+
+		var reversed uint32
+
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | (code>>i)&1
+		}
+
+		h.codes[s] = reversed
+	}
+
+	return h
+}
+
+// build the huffman tree and save the depth of every symbol, returns the max depth
+func getHuffmanLengths(counts []uint32, symbols []int, lengths []uint8) int {
+
+	type node struct {
+		count       uint64
+		symbol      int
+		left, right *node
+	}
+
+	nodes := make([]*node, 0, len(symbols))
+
+	for _, s := range symbols {
+		nodes = append(nodes, &node{count: uint64(counts[s]), symbol: s})
+	}
+
+	for len(nodes) > 1 {
+		// stable, so the same counts always build the same tree
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].count < nodes[j].count
+		})
+
+		merged := &node{count: nodes[0].count + nodes[1].count, symbol: -1, left: nodes[0], right: nodes[1]}
+
+		nodes = append([]*node{merged}, nodes[2:]...)
+	}
+
+	var (
+		maxDepth = 0
+		walk     func(n *node, depth int)
+	)
+
+	walk = func(n *node, depth int) {
+		if n.symbol >= 0 {
+			lengths[n.symbol] = uint8(depth)
+
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+
+			return
+		}
+
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+
+	walk(nodes[0], 0)
+
+	return maxDepth
+}
+
+func (h *huffmanCode) writeSymbol(bw *bitWriter, symbol int) {
+	if len(h.symbols) <= 1 {
+		return
+	}
+
+	bw.write(h.codes[symbol], uint(h.lengths[symbol]))
+}
+
+func (h *huffmanCode) writeHeader(bw *bitWriter) {
+
+	// the simple code is used for one or two symbols less than 256
+	if len(h.symbols) <= 2 && (len(h.symbols) == 0 || h.symbols[len(h.symbols)-1] < 256) {
+		symbols := h.symbols
+
+		if len(symbols) == 0 {
+			symbols = []int{0}
+		}
+
+		bw.write(1, 1)
+		bw.write(uint32(len(symbols)-1), 1)
+
+		if symbols[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbols[0]), 8)
+		}
+
+		if len(symbols) == 2 {
+			bw.write(uint32(symbols[1]), 8)
+		}
+
+		return
+	}
+
+	// normal code, the code lengths are written with another prefix code
+	bw.write(0, 1)
+
+	type token struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+
+	var (
+		tokens  = make([]token, 0)
+		lengths = h.lengths
+	)
+
+	for i := 0; i < len(lengths); {
+		l := int(lengths[i])
+		run := 1
+
+		for i+run < len(lengths) && int(lengths[i+run]) == l {
+			run++
+		}
+
+		i += run
+
+		if l == 0 {
+			for run > 0 {
+				switch {
+				case run >= 11:
+					n := run
+
+					if n > 138 {
+						n = 138
+					}
+
+					tokens = append(tokens, token{18, uint32(n - 11), 7})
+					run -= n
+				case run >= 3:
+					tokens = append(tokens, token{17, uint32(run - 3), 3})
+					run = 0
+				default:
+					tokens = append(tokens, token{0, 0, 0})
+					run--
+				}
+			}
+
+			continue
+		}
+
+		// 16 repeats the last non-zero length
+		tokens = append(tokens, token{l, 0, 0})
+		run--
+
+		for run > 0 {
+			if run < 3 {
+				tokens = append(tokens, token{l, 0, 0})
+				run--
+				continue
+			}
+
+			n := run
+
+			if n > 6 {
+				n = 6
+			}
+
+			tokens = append(tokens, token{16, uint32(n - 3), 2})
+			run -= n
+		}
+	}
+
+	clCounts := make([]uint32, 19)
+
+	for _, t := range tokens {
+		clCounts[t.symbol]++
+	}
+
+	cl := newHuffmanCode(clCounts, webpMaxCLCodeLen)
+
+	numCodes := len(webpCodeLengthOrder)
+
+	for numCodes > 4 && cl.lengths[webpCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bw.write(uint32(numCodes-4), 4)
+
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(cl.lengths[webpCodeLengthOrder[i]]), 3)
+	}
+
+	// all the symbols are written, no max_symbol
+	bw.write(0, 1)
+
+	for _, t := range tokens {
+		cl.writeSymbol(bw, t.symbol)
+		bw.write(t.extra, t.extraBits)
+	}
+}
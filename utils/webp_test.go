@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// noise with random alpha, flat areas and repeated rows, so every transform and backward references are used
+func newTestImage(width, height int, seed int64) *image.NRGBA {
+
+	var (
+		img = image.NewNRGBA(image.Rect(0, 0, width, height))
+		rng = rand.New(rand.NewSource(seed))
+	)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+
+			switch {
+			case y < height/4:
+				c = color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+			case y < height/2:
+				c = color.NRGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255}
+			case y < height*3/4:
+				c = color.NRGBA{200, 30, 60, 255}
+			default:
+				c = img.NRGBAAt(x, y-height/4)
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// transparent pixels keep their rgb in lossless webp, every channel is compared
+func assertSamePixels(t *testing.T, name string, want *image.NRGBA, got image.Image) {
+	t.Helper()
+
+	if got.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("%s: size %v, want %v", name, got.Bounds().Size(), want.Bounds().Size())
+	}
+
+	var (
+		b   = got.Bounds()
+		nrg = toNRGBA(got)
+	)
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if w, g := want.NRGBAAt(x, y), nrg.NRGBAAt(x, y); w != g {
+				t.Fatalf("%s: pixel (%d, %d) is %v, want %v", name, x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+
+	var cases = []struct {
+		name          string
+		width, height int
+	}{
+		{"single pixel", 1, 1},
+		{"odd size", 37, 19},
+		{"wide", 300, 8},
+		{"large", 256, 200},
+	}
+
+	for _, c := range cases {
+		want := newTestImage(c.width, c.height, int64(c.width*c.height))
+
+		var buf bytes.Buffer
+
+		if err := EncodeWebP(&buf, want); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		got, err := webp.Decode(&buf)
+
+		if err != nil {
+			t.Fatalf("%s: decode: %s", c.name, err)
+		}
+
+		assertSamePixels(t, c.name, want, got)
+	}
+}
+
+func TestEncodeWebPOpaque(t *testing.T) {
+
+	var want = image.NewNRGBA(image.Rect(0, 0, 64, 64))
+
+	for i := 0; i < len(want.Pix); i += 4 {
+		want.Pix[i], want.Pix[i+1], want.Pix[i+2], want.Pix[i+3] = uint8(i), uint8(i>>8), 90, 255
+	}
+
+	var buf bytes.Buffer
+
+	if err := EncodeWebP(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := webp.Decode(bytes.NewReader(buf.Bytes()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSamePixels(t, "opaque", want, got)
+}
+
+func TestEncodeWebPSize(t *testing.T) {
+
+	for _, size := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, webpMaxSize+1, 1)} {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(size)); err == nil {
+			t.Errorf("size %v: no error", size.Size())
+		}
+	}
+}